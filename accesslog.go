@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// AccessLogFormat is how AccessLog writes each proxied request.
+type AccessLogFormat int
+
+const (
+	// AccessLogText writes one human readable line per request.
+	AccessLogText AccessLogFormat = iota
+	// AccessLogJSON writes one JSON object per line.
+	AccessLogJSON
+)
+
+// ParseAccessLogFormat parses "text" or "json".
+func ParseAccessLogFormat(name string) (AccessLogFormat, error) {
+	switch name {
+	case "text":
+		return AccessLogText, nil
+	case "json":
+		return AccessLogJSON, nil
+	}
+	return AccessLogText, fmt.Errorf("unknown access log format %q", name)
+}
+
+// AccessLog records every request under the proxy prefix, including the ones
+// that never reach an upstream.
+type AccessLog struct {
+	logger *log.Logger
+	format AccessLogFormat
+}
+
+func NewAccessLog(out io.Writer, format AccessLogFormat) *AccessLog {
+	flags := log.LstdFlags
+	if format == AccessLogJSON {
+		flags = 0
+	}
+	return &AccessLog{logger: log.New(out, "", flags), format: format}
+}
+
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proxy      string    `json:"proxy"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// Log records r, which proxy served it (nil when none matched) and what was
+// written to sw.
+func (l *AccessLog) Log(r *http.Request, proxy *Proxy, sw *statusWriter, duration time.Duration) {
+	entry := accessLogEntry{
+		Time:       time.Now(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Status:     sw.Status(),
+		Bytes:      sw.bytes,
+		DurationMS: milliseconds(duration),
+	}
+	if proxy != nil {
+		entry.Proxy = proxy.Path
+	}
+	if l.format == AccessLogJSON {
+		line, _ := json.Marshal(entry)
+		l.logger.Print(string(line))
+		return
+	}
+	name := entry.Proxy
+	if name == "" {
+		name = "-"
+	}
+	l.logger.Printf("%s %s proxy=%s status=%d bytes=%d duration=%s", entry.Method, entry.Path, name, entry.Status, entry.Bytes, duration)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogJSON(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+	defer backend.Close()
+
+	var out syncBuffer
+	app := Subject()
+	app.AccessLog = NewAccessLog(&out, AccessLogJSON)
+	app.Register(backend.URL, "pot")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	get(t, server.URL+"/proxy/pot/brew")
+	get(t, server.URL+"/proxy/missing/")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %q", out.String())
+	}
+	var entry accessLogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if entry.Method != "GET" || entry.Path != "/proxy/pot/brew" || entry.Proxy != "pot" || entry.Status != http.StatusTeapot || entry.Bytes != 15 {
+		t.Errorf("Unexpected log entry %+v", entry)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if entry.Proxy != "" || entry.Status != http.StatusNotFound {
+		t.Errorf("Expected an unmatched 404 entry, got %+v", entry)
+	}
+}
+
+func TestAccessLogStreaming(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer backend.Close()
+
+	var out syncBuffer
+	app := Subject()
+	app.AccessLog = NewAccessLog(&out, AccessLogText)
+	app.Register(backend.URL, "stream")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/proxy/stream/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	reader := bufio.NewReader(res.Body)
+	if line, _ := reader.ReadString('\n'); line != "first\n" {
+		t.Errorf("Expected the first chunk before the response ended, got %q", line)
+	}
+	close(release)
+	reader.ReadString('\n')
+	res.Body.Close()
+	server.Close()
+
+	if logged := out.String(); !strings.Contains(logged, "GET /proxy/stream/ proxy=stream status=200") {
+		t.Errorf("Expected a text log line, got %q", logged)
+	}
+}
+
+func TestParseAccessLogFormat(t *testing.T) {
+	if _, err := ParseAccessLogFormat("xml"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultInitialLimit = 20
+	DefaultMinLimit     = 1
+	DefaultMaxLimit     = 1000
+	DefaultRTTWindow    = 100
+)
+
+// AdaptiveLimiter caps a proxy's concurrent requests with a limit that follows
+// the backend's latency. Each response compares the best latency seen with
+// the latest one: while they match the limit grows by a small queue
+// allowance, and as latency climbs the limit shrinks in proportion, so a
+// struggling backend is shed load instead of queueing more. The best latency
+// is taken over the last two windows of RTTWindow samples, so it follows a
+// backend whose baseline latency changes.
+type AdaptiveLimiter struct {
+	sync.Mutex
+	limit     float64
+	inFlight  int
+	minRTT    time.Duration
+	windowRTT time.Duration
+	samples   int
+	shed      int64
+	MinLimit  int
+	MaxLimit  int
+	RTTWindow int
+}
+
+func NewAdaptiveLimiter() *AdaptiveLimiter {
+	return &AdaptiveLimiter{limit: DefaultInitialLimit, MinLimit: DefaultMinLimit, MaxLimit: DefaultMaxLimit, RTTWindow: DefaultRTTWindow}
+}
+
+// Acquire reserves a slot for a request, returning false when the limit is
+// reached and the request should be shed.
+func (l *AdaptiveLimiter) Acquire() bool {
+	l.Lock()
+	defer l.Unlock()
+	if l.inFlight >= int(l.limit) {
+		l.shed++
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// Release frees a slot and adjusts the limit by the request's latency.
+func (l *AdaptiveLimiter) Release(rtt time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	inFlight := l.inFlight
+	l.inFlight--
+	if rtt <= 0 {
+		return
+	}
+	minRTT := l.sample(rtt)
+	gradient := math.Max(0.5, math.Min(1, float64(minRTT)/float64(rtt)))
+	// Don't grow a limit the traffic isn't using.
+	if gradient == 1 && float64(inFlight) < l.limit/2 {
+		return
+	}
+	target := l.limit*gradient + math.Sqrt(l.limit)
+	limit := 0.8*l.limit + 0.2*target
+	l.limit = math.Max(float64(l.MinLimit), math.Min(float64(l.MaxLimit), limit))
+}
+
+// Drop frees a slot without adjusting the limit, for requests that failed.
+// A fast error says nothing about the backend's latency.
+func (l *AdaptiveLimiter) Drop() {
+	l.Lock()
+	defer l.Unlock()
+	l.inFlight--
+}
+
+// sample adds rtt to the current window and returns the best latency over
+// it and the previous one. The lock must be held.
+func (l *AdaptiveLimiter) sample(rtt time.Duration) time.Duration {
+	if l.windowRTT == 0 || rtt < l.windowRTT {
+		l.windowRTT = rtt
+	}
+	minRTT := l.windowRTT
+	if l.minRTT != 0 && l.minRTT < minRTT {
+		minRTT = l.minRTT
+	}
+	l.samples++
+	if l.samples >= l.RTTWindow {
+		l.minRTT = l.windowRTT
+		l.windowRTT = 0
+		l.samples = 0
+	}
+	return minRTT
+}
+
+// Limit is the current number of concurrent requests allowed.
+func (l *AdaptiveLimiter) Limit() int {
+	l.Lock()
+	defer l.Unlock()
+	return int(l.limit)
+}
+
+// Shed is the number of requests rejected so far.
+func (l *AdaptiveLimiter) Shed() int64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.shed
+}
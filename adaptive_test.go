@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// saturate fills every slot of l and releases them all with latency rtt.
+func saturate(l *AdaptiveLimiter, rtt time.Duration) {
+	acquired := 0
+	for l.Acquire() {
+		acquired++
+	}
+	for i := 0; i < acquired; i++ {
+		l.Release(rtt)
+	}
+}
+
+func TestAdaptiveLimiterShrinksWithLatency(t *testing.T) {
+	l := NewAdaptiveLimiter()
+	for i := 0; i < 5; i++ {
+		saturate(l, 10*time.Millisecond)
+	}
+	steady := l.Limit()
+	if steady < DefaultInitialLimit {
+		t.Errorf("Expected the limit to hold or grow at steady latency, got %d", steady)
+	}
+
+	for _, rtt := range []time.Duration{20, 40, 80, 160} {
+		saturate(l, rtt*time.Millisecond)
+	}
+	if l.Limit() >= steady/2 {
+		t.Errorf("Expected rising latency to cut the limit below %d, got %d", steady/2, l.Limit())
+	}
+
+	for i := 0; i < l.Limit(); i++ {
+		l.Acquire()
+	}
+	shed := l.Shed()
+	if l.Acquire() {
+		t.Error("Expected requests over the limit to be shed")
+	}
+	if l.Shed() != shed+1 {
+		t.Errorf("Expected shed to be counted, got %d", l.Shed())
+	}
+}
+
+func TestAdaptiveLimiterFollowsNewBaseline(t *testing.T) {
+	l := NewAdaptiveLimiter()
+	l.RTTWindow = 10
+	saturate(l, 10*time.Millisecond)
+	for i := 0; i < 20; i++ {
+		saturate(l, 40*time.Millisecond)
+	}
+	shrunk := l.Limit()
+	for i := 0; i < 20; i++ {
+		saturate(l, 40*time.Millisecond)
+	}
+	if l.Limit() < shrunk {
+		t.Errorf("Expected the limit to recover once the slower latency is the baseline, got %d after %d", l.Limit(), shrunk)
+	}
+}
+
+func TestAdaptiveLimiterIgnoresFailures(t *testing.T) {
+	l := NewAdaptiveLimiter()
+	for i := 0; i < 10; i++ {
+		l.Acquire()
+		l.Drop()
+	}
+	for i := 0; i < 5; i++ {
+		saturate(l, 10*time.Millisecond)
+	}
+	if l.Limit() < DefaultInitialLimit {
+		t.Errorf("Expected failed requests not to count as latency samples, got limit %d", l.Limit())
+	}
+}
+
+func TestAdaptiveConcurrencySheds(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "limited", ProxyOptions{AdaptiveConcurrency: true})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res := fetch(t, server.URL+"/proxy/limited/")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 under the limit, got %d", res.StatusCode)
+	}
+
+	proxy, _ := app.Find("limited")
+	for proxy.Limiter.Acquire() {
+	}
+	res = fetch(t, server.URL+"/proxy/limited/")
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the limit is reached, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header on shed requests")
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "net/http"
+
+// requiredHeaders survive an AllowRequestHeaders allowlist, since the
+// request can't be framed or upgraded without them.
+var requiredHeaders = []string{"Content-Length", "Transfer-Encoding", "Te", "Connection", "Upgrade"}
+
+// filterRequestHeaders drops every client header not in the proxy's
+// AllowRequestHeaders. Headers reverser adds itself are set afterwards.
+func (p *Proxy) filterRequestHeaders(req *http.Request) {
+	if len(p.AllowRequestHeaders) == 0 {
+		return
+	}
+	allowed := make(map[string]bool, len(p.AllowRequestHeaders)+len(requiredHeaders))
+	for _, name := range append(p.AllowRequestHeaders, requiredHeaders...) {
+		allowed[http.CanonicalHeaderKey(name)] = true
+	}
+	for name := range req.Header {
+		if !allowed[name] {
+			req.Header.Del(name)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAllowRequestHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Via = ""
+	app.RegisterWithOptions(backend.URL, "strict", ProxyOptions{
+		AllowRequestHeaders: []string{"content-type", "X-Request-Id"},
+		ProxyDefaults:       ProxyDefaults{Headers: map[string]string{"X-Added": "by reverser"}},
+	})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/proxy/strict/", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", "abc")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("X-Internal", "1")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+
+	header := <-received
+	for name, value := range map[string]string{"Content-Type": "application/json", "X-Request-Id": "abc", "X-Added": "by reverser", "Content-Length": "2"} {
+		if header.Get(name) != value {
+			t.Errorf("Expected %s to be %s, got %s", name, value, header.Get(name))
+		}
+	}
+	for _, name := range []string{"Cookie", "X-Internal", "User-Agent"} {
+		if header.Get(name) != "" {
+			t.Errorf("Expected %s to be dropped, got %s", name, header.Get(name))
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ConnectivityResult reports the outcome of a single request to an upstream.
+type ConnectivityResult struct {
+	Status    int     `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// TestProxy makes one GET request to the proxy's target using the same
+// transport and timeout as proxied traffic. Without a timeout it gives up
+// after DefaultHealthTimeout rather than hanging the API call.
+func (app *App) TestProxy(proxy *Proxy) ConnectivityResult {
+	timeout := app.timeoutFor(proxy)
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	client := &http.Client{
+		Transport: app.transportFor(proxy),
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	result := ConnectivityResult{}
+	start := time.Now()
+	res, err := client.Get(proxy.URL.String())
+	result.LatencyMS = milliseconds(time.Since(start))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	res.Body.Close()
+	result.Status = res.StatusCode
+	return result
+}
+
+// wantsJSON reports whether the client sent or asked for JSON rather than a
+// browser form.
+func wantsJSON(r *http.Request) bool {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == "application/json" {
+		return true
+	}
+	return r.Header.Get("Accept") == "application/json"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// HandleAPI registers an admin API handler behind the authenticator. Changes
+// must be sent as JSON.
+func (app *App) HandleAPI(path string, handler http.HandlerFunc) *mux.Route {
+	return app.Router.Handle(app.Link(path), app.requireAuth(app.throttleMutations(requireJSON(handler))))
+}
+
+// requireJSON answers 415 to requests that change state, anything but GET
+// and HEAD, unless they are declared as JSON. Browsers send cross-site form
+// and text/plain POSTs without asking first, with the user's credentials
+// attached; a JSON request needs a preflight.
+func requireJSON(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			next(w, r)
+			return
+		}
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		next(w, r)
+	}
+}
+
+const redacted = "xxxxx"
+
+// ProxyView is how the API lists a proxy. Secrets and credentials in its
+// targets and options are redacted; only the FileStore on disk keeps them.
+type ProxyView struct {
+	Path    string       `json:"path"`
+	Target  string       `json:"target"`
+	Options ProxyOptions `json:"options"`
+}
+
+func NewProxyView(proxy *Proxy) ProxyView {
+	targets := make([]string, len(proxy.Backends))
+	for i, backend := range proxy.Backends {
+		targets[i] = backend.Redacted()
+	}
+	opts := proxy.ProxyOptions
+	opts.UpstreamProxy = redactURL(opts.UpstreamProxy)
+	opts.CanaryTarget = redactURL(opts.CanaryTarget)
+	if opts.HMACSecret != "" {
+		opts.HMACSecret = redacted
+	}
+	if len(opts.Headers) > 0 {
+		headers := make(map[string]string, len(opts.Headers))
+		for name, value := range opts.Headers {
+			switch http.CanonicalHeaderKey(name) {
+			case "Authorization", "Proxy-Authorization", "Cookie":
+				value = redacted
+			}
+			headers[name] = value
+		}
+		opts.Headers = headers
+	}
+	return ProxyView{Path: proxy.Path, Target: strings.Join(targets, ","), Options: opts}
+}
+
+// redactURL hides the password of a URL, leaving anything unparseable as is.
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.User == nil {
+		return raw
+	}
+	return parsed.Redacted()
+}
+
+// ProxyViews lists proxies for the API, keyed by path.
+func ProxyViews(proxies map[string]*Proxy) map[string]ProxyView {
+	views := make(map[string]ProxyView, len(proxies))
+	for path, proxy := range proxies {
+		views[path] = NewProxyView(proxy)
+	}
+	return views
+}
+
+// ProxyDetail is the API view of a single proxy and its live counters.
+type ProxyDetail struct {
+	Path     string   `json:"path"`
+	Target   string   `json:"target"`
+	Backends []string `json:"backends"`
+	InFlight int64    `json:"in_flight"`
+	P50MS    float64  `json:"p50_ms"`
+	P95MS    float64  `json:"p95_ms"`
+	P99MS    float64  `json:"p99_ms"`
+
+	ConcurrencyLimit int   `json:"concurrency_limit,omitempty"`
+	Shed             int64 `json:"shed,omitempty"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func NewProxyDetail(proxy *Proxy) ProxyDetail {
+	detail := ProxyDetail{
+		Path:     proxy.Path,
+		Target:   proxy.URL.Redacted(),
+		InFlight: proxy.Stats.InFlight(),
+		P50MS:    milliseconds(proxy.Stats.Latency.Quantile(0.5)),
+		P95MS:    milliseconds(proxy.Stats.Latency.Quantile(0.95)),
+		P99MS:    milliseconds(proxy.Stats.Latency.Quantile(0.99)),
+	}
+	if proxy.Limiter != nil {
+		detail.ConcurrencyLimit = proxy.Limiter.Limit()
+		detail.Shed = proxy.Limiter.Shed()
+	}
+	for _, backend := range proxy.Backends {
+		detail.Backends = append(detail.Backends, backend.Redacted())
+	}
+	return detail
+}
+
+// registerRequest is the body of POST /api/proxies.
+type registerRequest struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// storeErrorStatus maps a store error to the status reported for it.
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAlreadyExists):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func (app *App) MountAPIHandlers() {
+	app.HandleAPI("/api/proxies", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ProxyViews(app.ProxyList()))
+	}).Methods("GET")
+	app.HandleAPI("/api/proxies", func(w http.ResponseWriter, r *http.Request) {
+		var req registerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Path == "" || req.Target == "" {
+			writeJSONError(w, http.StatusBadRequest, "path and target are required")
+			return
+		}
+		proxy, err := app.RegisterProxy(req.Target, req.Path)
+		if err != nil {
+			writeJSONError(w, storeErrorStatus(err), err.Error())
+			return
+		}
+		app.Audit(r, "register", proxy.Path, "", proxy.Target())
+		writeJSON(w, http.StatusCreated, NewProxyView(proxy))
+	}).Methods("POST")
+	app.HandleAPI("/api/proxies/{path}", func(w http.ResponseWriter, r *http.Request) {
+		proxy, err := app.Find(mux.Vars(r)["path"])
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err := app.Unregister(proxy.Path); err != nil {
+			writeJSONError(w, storeErrorStatus(err), err.Error())
+			return
+		}
+		app.Audit(r, "unregister", proxy.Path, proxy.Target(), "")
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	app.HandleAPI("/api/proxies/{path}", func(w http.ResponseWriter, r *http.Request) {
+		proxy, err := app.Find(mux.Vars(r)["path"])
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, NewProxyDetail(proxy))
+	}).Methods("GET")
+	app.HandleAPI("/api/proxies/{path}/metrics", func(w http.ResponseWriter, r *http.Request) {
+		proxy, err := app.Find(mux.Vars(r)["path"])
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, proxy.Stats.Buckets(time.Now()))
+	}).Methods("GET")
+	app.HandleAPI("/api/proxies/{path}/test", func(w http.ResponseWriter, r *http.Request) {
+		proxy, err := app.Find(mux.Vars(r)["path"])
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, app.TestProxy(proxy))
+	}).Methods("POST")
+	app.HandleAPI("/api/proxies/{path}/reload", func(w http.ResponseWriter, r *http.Request) {
+		proxy, err := app.Find(mux.Vars(r)["path"])
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		app.ReloadTransport(proxy)
+		writeJSON(w, http.StatusOK, NewProxyDetail(proxy))
+	}).Methods("POST")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one change to the registered proxies. User is empty when
+// admin auth is off.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	Path      string    `json:"path"`
+	OldTarget string    `json:"old_target,omitempty"`
+	NewTarget string    `json:"new_target,omitempty"`
+}
+
+// AuditLog appends every successful register, update and unregister, and
+// every eviction and expiry, to out as JSON lines. It is safe for concurrent use.
+type AuditLog struct {
+	sync.Mutex
+	out io.Writer
+}
+
+func NewAuditLog(out io.Writer) *AuditLog {
+	return &AuditLog{out: out}
+}
+
+// OpenAuditLog appends to the file at path, creating it if needed.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLog(file), nil
+}
+
+func (l *AuditLog) Record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	_, err = l.out.Write(append(line, '\n'))
+	return err
+}
+
+// SystemUser is the audit log user for changes the server makes on its own,
+// such as evictions and expiry.
+const SystemUser = "system"
+
+// Audit records a change made by r to the audit log, if there is one.
+func (app *App) Audit(r *http.Request, action string, path string, oldTarget string, newTarget string) {
+	app.audit(User(r), action, path, oldTarget, newTarget)
+}
+
+// AuditSystem records a change the server made without a request.
+func (app *App) AuditSystem(action string, path string, oldTarget string, newTarget string) {
+	app.audit(SystemUser, action, path, oldTarget, newTarget)
+}
+
+func (app *App) audit(user string, action string, path string, oldTarget string, newTarget string) {
+	if app.AuditLog == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		User:      user,
+		Action:    action,
+		Path:      path,
+		OldTarget: oldTarget,
+		NewTarget: newTarget,
+	}
+	if err := app.AuditLog.Record(entry); err != nil {
+		app.Logger.Printf("audit log: %s", err)
+	}
+}
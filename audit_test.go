@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditRegister(t *testing.T) {
+	app := Subject()
+	app.Authenticator = BasicAuth{Username: "admin", Password: "secret"}
+	var out bytes.Buffer
+	app.AuditLog = NewAuditLog(&out)
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/api/proxies", strings.NewReader(`{"path":"audited","target":"http://example.com"}`))
+	req.SetBasicAuth("admin", "secret")
+	req.Header.Set("Content-Type", "application/json")
+	if res := status(t, req); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, res.StatusCode)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %q", out.String())
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if entry.User != "admin" || entry.Action != "register" || entry.Path != "audited" || entry.OldTarget != "" || entry.NewTarget != "http://example.com" {
+		t.Errorf("Unexpected audit entry %+v", entry)
+	}
+	if entry.Time.IsZero() {
+		t.Errorf("Expected the entry to be timestamped")
+	}
+
+	req, _ = http.NewRequest("POST", server.URL+"/api/proxies", strings.NewReader(`{"path":"audited","target":"http://example.com"}`))
+	req.SetBasicAuth("admin", "secret")
+	req.Header.Set("Content-Type", "application/json")
+	if res := status(t, req); res.StatusCode != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d", http.StatusConflict, res.StatusCode)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("Expected failed changes not to be audited, got %q", out.String())
+	}
+}
+
+func TestAuditEvictionAndExpiry(t *testing.T) {
+	store := NewStore()
+	store.MaxProxies = 1
+	store.Eviction = EvictLRU
+	app := NewApp(template.Must(LoadTemplates("")), store)
+	app.Setup()
+	var out bytes.Buffer
+	app.AuditLog = NewAuditLog(&out)
+
+	app.RegisterWithOptions("http://a.example.com", "first", ProxyOptions{ExpiresAt: time.Now().Add(-time.Second)})
+	app.RegisterWithOptions("http://b.example.com", "second", ProxyOptions{ExpiresAt: time.Now().Add(-time.Second)})
+	app.SweepExpired()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %q", out.String())
+	}
+	expected := []AuditEntry{
+		{User: SystemUser, Action: "evict", Path: "first", OldTarget: "http://a.example.com"},
+		{User: SystemUser, Action: "expire", Path: "second", OldTarget: "http://b.example.com"},
+	}
+	for i, line := range lines {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		entry.Time = time.Time{}
+		if entry != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], entry)
+		}
+	}
+}
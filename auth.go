@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+// Authenticator decides whether a request to the admin UI or API is allowed,
+// returning the name of the authenticated user.
+type Authenticator interface {
+	Authenticate(r *http.Request) (user string, ok bool)
+}
+
+// Challenger is implemented by authenticators that want a WWW-Authenticate
+// header sent with 401 responses.
+type Challenger interface {
+	Challenge() string
+}
+
+// BasicAuth authenticates a single user with HTTP basic auth.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(r *http.Request) (string, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(a.Password)) == 1
+	if !userOK || !passOK {
+		return "", false
+	}
+	return user, true
+}
+
+func (a BasicAuth) Challenge() string {
+	return `Basic realm="reverser"`
+}
+
+// adminAuthenticator returns basic auth for the given admin credentials, or
+// nil, leaving the admin routes open, when neither is set.
+func adminAuthenticator(user, pass string) Authenticator {
+	if user == "" && pass == "" {
+		return nil
+	}
+	return BasicAuth{Username: user, Password: pass}
+}
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	inboundMethodKey
+	proxyPrefixKey
+)
+
+// User returns the authenticated user for the request, if any.
+func User(r *http.Request) string {
+	user, _ := r.Context().Value(userKey).(string)
+	return user
+}
+
+// requireAuth guards an admin handler with app.Authenticator. Auth is off
+// when no authenticator is configured.
+func (app *App) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.Authenticator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := app.Authenticator.Authenticate(r)
+		if !ok {
+			if challenger, ok := app.Authenticator.(Challenger); ok {
+				w.Header().Set("WWW-Authenticate", challenger.Challenge())
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	})
+}
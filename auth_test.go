@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type tokenAuth string
+
+func (a tokenAuth) Authenticate(r *http.Request) (string, bool) {
+	if r.Header.Get("Authorization") != "Bearer "+string(a) {
+		return "", false
+	}
+	return "robot", true
+}
+
+func status(t *testing.T, req *http.Request) *http.Response {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestCustomAuthenticator(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Authenticator = tokenAuth("secret")
+	app.Register(backend.URL, "open")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+
+	req, _ = http.NewRequest("POST", server.URL+"/api/proxies/open/test", nil)
+	if res := status(t, req); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected API status %d without a token, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d with a token, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/proxy/open/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected proxied status %d without a token, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	app := Subject()
+	app.Authenticator = BasicAuth{Username: "admin", Password: "hunter2"}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	req.SetBasicAuth("admin", "wrong")
+	res := status(t, req)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+	if res.Header.Get("WWW-Authenticate") == "" {
+		t.Error("Expected a WWW-Authenticate challenge")
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/", nil)
+	req.SetBasicAuth("admin", "hunter2")
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestAdminAuthenticator(t *testing.T) {
+	if auth := adminAuthenticator("", ""); auth != nil {
+		t.Errorf("Expected no authenticator without credentials, got %v", auth)
+	}
+	auth := adminAuthenticator("admin", "hunter2")
+	req := httptest.NewRequest("GET", "/register", nil)
+	if _, ok := auth.Authenticate(req); ok {
+		t.Error("Expected a request without credentials to be rejected")
+	}
+	req.SetBasicAuth("admin", "hunter2")
+	if user, ok := auth.Authenticate(req); !ok || user != "admin" {
+		t.Errorf("Expected admin to be authenticated, got %q %v", user, ok)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer picks which of a proxy's backends serves a request. Implementations
+// must be safe for concurrent use.
+type Balancer interface {
+	Pick(req *http.Request, backends []*url.URL) *url.URL
+}
+
+// BalancerSpec is a serializable choice of Balancer. Type is "round-robin",
+// the default, "failover", "shard" on the path segment Segment, or
+// "weighted" by Weights with a SlowStart ramp for recovered backends.
+type BalancerSpec struct {
+	Type      string
+	Segment   int            `json:",omitempty"`
+	Weights   map[string]int `json:",omitempty"`
+	SlowStart time.Duration  `json:",omitempty"`
+}
+
+func (spec *BalancerSpec) validate() error {
+	if spec == nil {
+		return nil
+	}
+	switch spec.Type {
+	case "", "round-robin", "failover", "shard":
+		return nil
+	case "weighted":
+		for backend, weight := range spec.Weights {
+			if weight < 0 {
+				return fmt.Errorf("negative weight %d for %s", weight, backend)
+			}
+		}
+		if spec.SlowStart < 0 {
+			return fmt.Errorf("negative slow start %s", spec.SlowStart)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown balancer %q", spec.Type)
+}
+
+// build returns the Balancer spec describes, nil for round robin. Balancers
+// that follow backend health use health.
+func (spec *BalancerSpec) build(health *Health) Balancer {
+	if spec == nil {
+		return nil
+	}
+	switch spec.Type {
+	case "failover":
+		return FailoverBalancer{Health: health}
+	case "shard":
+		return ShardBalancer{Segment: spec.Segment}
+	case "weighted":
+		return WeightedBalancer{Health: health, Weights: spec.Weights, SlowStart: spec.SlowStart}
+	}
+	return nil
+}
+
+// balanced returns proxy with the Balancer its BalancerSpec describes. The
+// copy shares the proxy's runtime state; a Balancer set in code wins.
+func (app *App) balanced(proxy *Proxy) *Proxy {
+	if proxy.Balancer != nil || proxy.BalancerSpec == nil {
+		return proxy
+	}
+	balanced := *proxy
+	balanced.Balancer = proxy.BalancerSpec.build(app.Health)
+	return &balanced
+}
+
+// ShardBalancer hashes one segment of the forwarded path so requests for the
+// same key always reach the same backend. Segment counts from the start of
+// the path, or from the end when negative (-1 is the last segment).
+type ShardBalancer struct {
+	Segment int
+}
+
+func (b ShardBalancer) Pick(req *http.Request, backends []*url.URL) *url.URL {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	i := b.Segment
+	if i < 0 {
+		i += len(segments)
+	}
+	key := ""
+	if i >= 0 && i < len(segments) {
+		key = segments[i]
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return backends[hash.Sum32()%uint32(len(backends))]
+}
+
+// minSlowStart is the share of its weight a backend gets the moment it
+// recovers, so it still sees a trickle of traffic.
+const minSlowStart = 0.01
+
+// WeightedBalancer picks backends at random in proportion to their weight,
+// keyed by backend URL and defaulting to 1. With Health set, unhealthy
+// backends get no traffic, and a backend that just recovered has its weight
+// ramped up linearly over SlowStart so a cold instance isn't swamped.
+type WeightedBalancer struct {
+	Health    *Health
+	Weights   map[string]int
+	SlowStart time.Duration
+
+	now func() time.Time
+}
+
+func (b WeightedBalancer) weight(backend *url.URL, now time.Time) float64 {
+	weight := 1.0
+	if w, ok := b.Weights[backend.String()]; ok {
+		weight = float64(w)
+	}
+	if b.Health == nil {
+		return weight
+	}
+	status, ok := b.Health.Status(backend)
+	if !ok {
+		return weight
+	}
+	if !status.Healthy {
+		return 0
+	}
+	if b.SlowStart > 0 && !status.Since.IsZero() {
+		if elapsed := now.Sub(status.Since); elapsed < b.SlowStart {
+			ramp := float64(elapsed) / float64(b.SlowStart)
+			if ramp < minSlowStart {
+				ramp = minSlowStart
+			}
+			weight *= ramp
+		}
+	}
+	return weight
+}
+
+func (b WeightedBalancer) Pick(req *http.Request, backends []*url.URL) *url.URL {
+	now := time.Now()
+	if b.now != nil {
+		now = b.now()
+	}
+	weights := make([]float64, len(backends))
+	total := 0.0
+	for i, backend := range backends {
+		weights[i] = b.weight(backend, now)
+		total += weights[i]
+	}
+	if total == 0 {
+		return backends[0]
+	}
+	choice := rand.Float64() * total
+	for i, weight := range weights {
+		if choice < weight {
+			return backends[i]
+		}
+		choice -= weight
+	}
+	return backends[len(backends)-1]
+}
+
+// ParseTargets parses and validates a comma separated list of target URLs.
+func ParseTargets(target string) ([]*url.URL, error) {
+	var targets []*url.URL
+	for _, raw := range strings.Split(target, ",") {
+		targetURL, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		if err := validateTarget(targetURL); err != nil {
+			return nil, err
+		}
+		targets = append(targets, targetURL)
+	}
+	return targets, nil
+}
+
+// validateTarget rejects targets a proxy can't forward to: anything but an
+// http or https URL with a host, or a file URL with a path.
+func validateTarget(target *url.URL) error {
+	switch target.Scheme {
+	case "http", "https":
+		if target.Host == "" {
+			return fmt.Errorf("target %q has no host", target.String())
+		}
+	case "file":
+		if target.Path == "" {
+			return fmt.Errorf("target %q has no directory path", target.String())
+		}
+	case "":
+		return fmt.Errorf("target %q has no scheme, expected http:// or https://", target.String())
+	default:
+		return fmt.Errorf("target %q has unsupported scheme %s, expected http or https", target.String(), target.Scheme)
+	}
+	return nil
+}
+
+// RoundRobinBalancer cycles through the backends in order. Proxies with
+// several backends and no Balancer use one.
+type RoundRobinBalancer struct {
+	next uint64
+}
+
+func (b *RoundRobinBalancer) Pick(req *http.Request, backends []*url.URL) *url.URL {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return backends[n%uint64(len(backends))]
+}
+
+// backend returns the upstream for req: the canary when requested, the
+// balancer's choice when the proxy has several backends, otherwise its URL.
+func (p *Proxy) backend(req *http.Request) *url.URL {
+	if p.isCanary(req) {
+		return p.Canary
+	}
+	if len(p.Backends) < 2 {
+		return p.URL
+	}
+	if p.Balancer == nil {
+		return p.roundRobin.Pick(req, p.Backends)
+	}
+	return p.Balancer.Pick(req, p.Backends)
+}
+
+// hostHeader is the Host to send to target. An explicit default port for the
+// scheme is left out, since some virtual hosts don't match "host:443".
+func hostHeader(target *url.URL) string {
+	if port := target.Port(); port != "" && port == defaultPort(target.Scheme) {
+		return strings.TrimSuffix(target.Host, ":"+port)
+	}
+	return target.Host
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func namedBackends(t *testing.T, names ...string) ([]string, func()) {
+	var urls []string
+	var servers []*httptest.Server
+	for _, name := range names {
+		name := name
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		servers = append(servers, server)
+		urls = append(urls, server.URL)
+	}
+	return urls, func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+}
+
+func TestShardBalancer(t *testing.T) {
+	urls, closeAll := namedBackends(t, "a", "b", "c")
+	defer closeAll()
+
+	app := Subject()
+	app.RegisterWithOptions(strings.Join(urls, ","), "cas", ProxyOptions{Balancer: ShardBalancer{Segment: -1}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	first := get(t, server.URL+"/proxy/cas/objects/deadbeef")
+	for i := 0; i < 5; i++ {
+		if hit := get(t, server.URL+"/proxy/cas/objects/deadbeef"); hit != first {
+			t.Errorf("Expected the same key to hit %s, got %s", first, hit)
+		}
+	}
+
+	hits := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		hits[get(t, fmt.Sprintf("%s/proxy/cas/objects/%d", server.URL, i))] = true
+	}
+	if len(hits) < 2 {
+		t.Errorf("Expected different keys to spread across backends, got %v", hits)
+	}
+}
+
+func TestShardBalancerFromConfig(t *testing.T) {
+	urls, closeAll := namedBackends(t, "a", "b", "c")
+	defer closeAll()
+
+	config, errs, err := LoadConfig(writeConfig(t, `{"proxies": [
+		{"path": "cas", "target": "`+strings.Join(urls, ",")+`", "options": {"balancer": {"type": "shard", "segment": -1}}}
+	]}`))
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("Unexpected error %v %v", err, errs)
+	}
+	app := Subject()
+	app.LoadProxies(config)
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	first := get(t, server.URL+"/proxy/cas/objects/deadbeef")
+	for i := 0; i < 5; i++ {
+		if hit := get(t, server.URL+"/proxy/cas/other/deadbeef"); hit != first {
+			t.Errorf("Expected the same last segment to hit %s, got %s", first, hit)
+		}
+	}
+}
+
+func share(balancer Balancer, backends []*url.URL, target *url.URL) float64 {
+	hits := 0
+	req := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 5000; i++ {
+		if balancer.Pick(req, backends) == target {
+			hits++
+		}
+	}
+	return float64(hits) / 5000
+}
+
+func TestWeightedBalancerSlowStart(t *testing.T) {
+	warm, _ := url.Parse("http://warm:8080")
+	cold, _ := url.Parse("http://cold:8080")
+	backends := []*url.URL{warm, cold}
+
+	recovered := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	health := NewHealth()
+	health.Set(warm, HealthStatus{Healthy: true, Checked: recovered.Add(-time.Hour)})
+	health.Set(cold, HealthStatus{Healthy: false, Checked: recovered.Add(-time.Minute)})
+	health.Set(cold, HealthStatus{Healthy: true, Checked: recovered})
+
+	now := recovered
+	balancer := WeightedBalancer{Health: health, SlowStart: time.Minute, now: func() time.Time { return now }}
+
+	now = recovered.Add(6 * time.Second)
+	early := share(balancer, backends, cold)
+	if early > 0.2 {
+		t.Errorf("Expected a freshly recovered backend to get a small share, got %.2f", early)
+	}
+	now = recovered.Add(30 * time.Second)
+	middle := share(balancer, backends, cold)
+	if middle <= early {
+		t.Errorf("Expected the share to grow over the window, got %.2f then %.2f", early, middle)
+	}
+	now = recovered.Add(2 * time.Minute)
+	if full := share(balancer, backends, cold); full < 0.4 || full > 0.6 {
+		t.Errorf("Expected an even share after the window, got %.2f", full)
+	}
+
+	health.Set(cold, HealthStatus{Healthy: false, Checked: now})
+	if down := share(balancer, backends, cold); down != 0 {
+		t.Errorf("Expected an unhealthy backend to get nothing, got %.2f", down)
+	}
+}
+
+func TestRoundRobinByDefault(t *testing.T) {
+	urls, closeAll := namedBackends(t, "a", "b")
+	defer closeAll()
+
+	app := Subject()
+	app.Register(strings.Join(urls, ","), "pool")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	var hits []string
+	for i := 0; i < 4; i++ {
+		hits = append(hits, get(t, server.URL+"/proxy/pool/"))
+	}
+	if got := strings.Join(hits, ""); got != "abab" {
+		t.Errorf("Expected requests to alternate abab, got %s", got)
+	}
+}
+
+func TestWeightedBalancerFromConfig(t *testing.T) {
+	config, errs, err := LoadConfig(writeConfig(t, `{"proxies": [
+		{"path": "app", "target": "http://a.example.com,http://b.example.com",
+			"options": {"balancer": {"type": "weighted", "weights": {"http://a.example.com": 3}, "slowstart": 60000000000}}},
+		{"path": "bad", "target": "http://a.example.com,http://b.example.com",
+			"options": {"balancer": {"type": "weighted", "weights": {"http://a.example.com": -1}}}}
+	]}`))
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("Unexpected error %v %v", err, errs)
+	}
+	app := Subject()
+	if loaded := app.LoadProxies(config); loaded != 1 {
+		t.Errorf("Expected the negative weight to be skipped, loaded %d", loaded)
+	}
+	proxy, err := app.Find("app")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	balancer, ok := app.balanced(proxy).Balancer.(WeightedBalancer)
+	if !ok {
+		t.Fatalf("Expected a weighted balancer, got %T", app.balanced(proxy).Balancer)
+	}
+	if balancer.SlowStart != time.Minute || balancer.Weights["http://a.example.com"] != 3 || balancer.Health != app.Health {
+		t.Errorf("Expected the spec's weights, slow start and the app's health, got %+v", balancer)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// UnexpectedBodyPolicy controls requests that carry a body on methods that
+// shouldn't have one: GET, HEAD and DELETE.
+type UnexpectedBodyPolicy int
+
+const (
+	// UnexpectedBodyForward sends the body upstream as is.
+	UnexpectedBodyForward UnexpectedBodyPolicy = iota
+	// UnexpectedBodyStrip drops the body before forwarding.
+	UnexpectedBodyStrip
+	// UnexpectedBodyReject answers the request with a 400.
+	UnexpectedBodyReject
+)
+
+var errUnexpectedBody = errors.New("request body not allowed for this method")
+
+// checkBody applies the proxy's UnexpectedBody policy to r.
+func (p *Proxy) checkBody(r *http.Request) error {
+	if p.UnexpectedBody == UnexpectedBodyForward || r.ContentLength == 0 {
+		return nil
+	}
+	if r.Method != "GET" && r.Method != "HEAD" && r.Method != "DELETE" {
+		return nil
+	}
+	if p.UnexpectedBody == UnexpectedBodyReject {
+		return errUnexpectedBody
+	}
+	r.Body = http.NoBody
+	r.ContentLength = 0
+	r.TransferEncoding = nil
+	r.Header.Del("Content-Length")
+	r.Header.Del("Transfer-Encoding")
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUnexpectedBodyPolicies(t *testing.T) {
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "forward", ProxyOptions{})
+	app.RegisterWithOptions(backend.URL, "strip", ProxyOptions{UnexpectedBody: UnexpectedBodyStrip})
+	app.RegisterWithOptions(backend.URL, "reject", ProxyOptions{UnexpectedBody: UnexpectedBodyReject})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	send := func(method string, path string) int {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader("payload"))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := send("GET", "/proxy/forward/"); status != http.StatusOK || <-received != "payload" {
+		t.Errorf("Expected the body to be forwarded by default, got %d", status)
+	}
+	if status := send("GET", "/proxy/strip/"); status != http.StatusOK {
+		t.Errorf("Expected 200 when stripping, got %d", status)
+	} else if body := <-received; body != "" {
+		t.Errorf("Expected the body to be stripped, got %q", body)
+	}
+	if status := send("DELETE", "/proxy/reject/"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 when rejecting, got %d", status)
+	}
+	if len(received) != 0 {
+		t.Error("Expected a rejected request not to reach the backend")
+	}
+	if status := send("POST", "/proxy/reject/"); status != http.StatusOK || <-received != "payload" {
+		t.Errorf("Expected POST bodies to be left alone, got %d", status)
+	}
+}
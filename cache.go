@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCacheBodyLimit is the largest response body a cache keeps.
+	DefaultCacheBodyLimit = 1 << 20
+	// DefaultCacheEntries caps the number of responses a proxy caches.
+	DefaultCacheEntries = 1000
+)
+
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	stored time.Time
+}
+
+// response builds a fresh response for req from the cached copy, marked
+// with the cache state.
+func (c *cachedResponse) response(req *http.Request, state string) *http.Response {
+	res := c.replay(req)
+	res.Header.Set("X-Cache", state)
+	if state == "STALE" {
+		res.Header.Add("Warning", `110 - "Response is Stale"`)
+	}
+	return res
+}
+
+// replay builds a fresh response for req from the cached copy.
+func (c *cachedResponse) replay(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.status, http.StatusText(c.status)),
+		StatusCode:    c.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+		Request:       req,
+	}
+}
+
+// cacheCall is an upstream request that identical concurrent misses wait on.
+type cacheCall struct {
+	done  chan struct{}
+	entry *cachedResponse
+	stale bool
+	err   error
+}
+
+// ResponseCache holds a proxy's cached responses, keyed by request URI.
+type ResponseCache struct {
+	sync.Mutex
+	entries map[string]*cachedResponse
+	calls   map[string]*cacheCall
+	now     func() time.Time
+}
+
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{
+		entries: make(map[string]*cachedResponse),
+		calls:   make(map[string]*cacheCall),
+		now:     time.Now,
+	}
+}
+
+// finish publishes the result of call, storing its response when it may be
+// reused, and wakes up the requests waiting on it.
+func (c *ResponseCache) finish(key string, call *cacheCall, ttl time.Duration, store bool) {
+	c.Lock()
+	if store {
+		if len(c.entries) >= DefaultCacheEntries {
+			for k, entry := range c.entries {
+				if c.now().Sub(entry.stored) >= ttl {
+					delete(c.entries, k)
+				}
+			}
+		}
+		if len(c.entries) < DefaultCacheEntries {
+			c.entries[key] = call.entry
+		}
+	}
+	delete(c.calls, key)
+	c.Unlock()
+	close(call.done)
+}
+
+// cacheTransport serves cacheable GETs from the proxy's cache for ttl.
+// Concurrent identical misses are coalesced into a single upstream request
+// whose response they all share. With staleOnError, an expired copy is
+// served, with a Warning, when the upstream fails or answers with a 5xx.
+type cacheTransport struct {
+	next         http.RoundTripper
+	cache        *ResponseCache
+	ttl          time.Duration
+	staleOnError bool
+
+	// keyHeaders are the headers QueryToHeader fills in from the query. They
+	// are part of the key, since the parameters no longer are.
+	keyHeaders []string
+}
+
+// staleFor returns the cached copy of key to serve in place of a failed
+// upstream response, or nil.
+func (t *cacheTransport) staleFor(key string, res *http.Response, err error) *cachedResponse {
+	if !t.staleOnError || (err == nil && res.StatusCode < 500) {
+		return nil
+	}
+	t.cache.Lock()
+	entry := t.cache.entries[key]
+	t.cache.Unlock()
+	if entry != nil && res != nil {
+		res.Body.Close()
+	}
+	return entry
+}
+
+// cacheableRequest reports whether req may be answered from the cache.
+// Requests carrying credentials or cookies are personal and always go
+// upstream.
+func cacheableRequest(req *http.Request) bool {
+	if req.Method != "GET" || (req.Body != nil && req.Body != http.NoBody) || isUpgrade(req) {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" {
+		return false
+	}
+	return !strings.Contains(req.Header.Get("Cache-Control"), "no-cache")
+}
+
+// cacheKey identifies the response to req. The upstream host is part of it,
+// so a canary's responses are kept apart from the stable target's, and so is
+// Accept-Encoding, since the upstream may compress for one client and not
+// another.
+func (t *cacheTransport) cacheKey(req *http.Request) string {
+	key := []string{req.URL.Host, req.URL.RequestURI(), req.Header.Get("Accept-Encoding")}
+	for _, name := range t.keyHeaders {
+		key = append(key, req.Header.Get(name))
+	}
+	return strings.Join(key, "\x00")
+}
+
+// storableResponse reports whether res may be shared with other clients.
+// Responses varying on anything but Accept-Encoding, which the key already
+// covers, aren't stored.
+func storableResponse(res *http.Response) bool {
+	cacheControl := res.Header.Get("Cache-Control")
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return false
+	}
+	for _, vary := range res.Header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	return res.StatusCode == http.StatusOK && res.Header.Get("Set-Cookie") == ""
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheableRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+	key := t.cacheKey(req)
+	c := t.cache
+	c.Lock()
+	if entry, ok := c.entries[key]; ok && c.now().Sub(entry.stored) < t.ttl {
+		c.Unlock()
+		return entry.response(req, "HIT"), nil
+	}
+	if call, ok := c.calls[key]; ok {
+		c.Unlock()
+		select {
+		case <-call.done:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		// A response too large to share, or a leader whose client went
+		// away, leaves this request to go upstream itself.
+		if call.entry == nil && (call.err == nil || errors.Is(call.err, context.Canceled)) {
+			return t.next.RoundTrip(req)
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		if call.stale {
+			return call.entry.response(req, "STALE"), nil
+		}
+		return call.entry.response(req, "HIT"), nil
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.Unlock()
+
+	res, err := t.next.RoundTrip(req)
+	if stale := t.staleFor(key, res, err); stale != nil {
+		call.entry, call.stale = stale, true
+		c.finish(key, call, t.ttl, false)
+		return stale.response(req, "STALE"), nil
+	}
+	if err != nil {
+		call.err = err
+		c.finish(key, call, t.ttl, false)
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, DefaultCacheBodyLimit+1))
+	if err != nil {
+		res.Body.Close()
+		call.err = err
+		c.finish(key, call, t.ttl, false)
+		return nil, err
+	}
+	if len(body) > DefaultCacheBodyLimit {
+		res.Body = readCloser{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		c.finish(key, call, t.ttl, false)
+		return res, nil
+	}
+	res.Body.Close()
+	call.entry = &cachedResponse{status: res.StatusCode, header: res.Header, body: body, stored: c.now()}
+	c.finish(key, call, t.ttl, storableResponse(res))
+	return call.entry.response(req, "MISS"), nil
+}
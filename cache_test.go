@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheCoalescesConcurrentMisses(t *testing.T) {
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&hits, 1)
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintf(w, "response %d", n)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "cached", ProxyOptions{CacheTTL: time.Minute})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 20)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := http.Get(server.URL + "/proxy/cached/page?q=1")
+			if err != nil {
+				t.Errorf("Unexpected error %s", err)
+				return
+			}
+			defer res.Body.Close()
+			body, _ := ioutil.ReadAll(res.Body)
+			bodies[i] = string(body)
+		}(i)
+	}
+	wg.Wait()
+
+	if hits != 1 {
+		t.Errorf("Expected the backend to be hit once, got %d", hits)
+	}
+	for _, body := range bodies {
+		if body != "response 1" {
+			t.Errorf("Expected every request to get the shared response, got %q", body)
+		}
+	}
+
+	res, err := http.Get(server.URL + "/proxy/cached/page?q=1")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.Header.Get("X-Cache") != "HIT" || atomic.LoadInt64(&hits) != 1 {
+		t.Errorf("Expected a cache hit, got %s after %d backend hits", res.Header.Get("X-Cache"), hits)
+	}
+	get(t, server.URL+"/proxy/cached/page?q=2")
+	if atomic.LoadInt64(&hits) != 2 {
+		t.Errorf("Expected a different query to miss, got %d backend hits", hits)
+	}
+}
+
+func TestCacheExpiresAndSkipsUncacheable(t *testing.T) {
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "cached", ProxyOptions{CacheTTL: time.Minute})
+	proxy, _ := app.Find("cached")
+	now := time.Now()
+	proxy.Cache.now = func() time.Time { return now }
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	get(t, server.URL+"/proxy/cached/public")
+	get(t, server.URL+"/proxy/cached/public")
+	get(t, server.URL+"/proxy/cached/private")
+	get(t, server.URL+"/proxy/cached/private")
+	if hits != 3 {
+		t.Errorf("Expected only the public response to be cached, got %d backend hits", hits)
+	}
+
+	now = now.Add(2 * time.Minute)
+	get(t, server.URL+"/proxy/cached/public")
+	if hits != 4 {
+		t.Errorf("Expected an expired response to be refetched, got %d backend hits", hits)
+	}
+}
+
+func TestCacheServesStaleOnError(t *testing.T) {
+	var failing int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("fresh copy"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "stale", ProxyOptions{CacheTTL: time.Minute, StaleOnError: true})
+	app.RegisterWithOptions(backend.URL, "strict", ProxyOptions{CacheTTL: time.Minute})
+	now := time.Now()
+	for _, path := range []string{"stale", "strict"} {
+		proxy, _ := app.Find(path)
+		proxy.Cache.now = func() time.Time { return now }
+	}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	get(t, server.URL+"/proxy/stale/page")
+	get(t, server.URL+"/proxy/strict/page")
+	atomic.StoreInt32(&failing, 1)
+	now = now.Add(2 * time.Minute)
+
+	res, err := http.Get(server.URL + "/proxy/stale/page")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "fresh copy" {
+		t.Errorf("Expected the stale copy, got %d %q", res.StatusCode, body)
+	}
+	if !strings.Contains(res.Header.Get("Warning"), "110") {
+		t.Errorf("Expected a stale Warning header, got %q", res.Header.Get("Warning"))
+	}
+
+	if res := fetch(t, server.URL+"/proxy/strict/page"); res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected the upstream error without StaleOnError, got %d", res.StatusCode)
+	}
+	backend.Close()
+	if res := fetch(t, server.URL+"/proxy/stale/page"); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the stale copy when the upstream is down, got %d", res.StatusCode)
+	}
+}
+
+func TestCacheRespectsVaryAndCookies(t *testing.T) {
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		switch r.URL.Path {
+		case "/encoded":
+			w.Header().Set("Vary", "Accept-Encoding")
+			w.Write([]byte(r.Header.Get("Accept-Encoding")))
+		case "/personal":
+			w.Header().Set("Vary", "Accept-Encoding, Cookie")
+			w.Write([]byte(r.Header.Get("Cookie")))
+		}
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "cached", ProxyOptions{CacheTTL: time.Minute})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	fetch := func(path string, header string, value string) string {
+		req, _ := http.NewRequest("GET", server.URL+"/proxy/cached"+path, nil)
+		req.Header.Set(header, value)
+		res, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return string(body)
+	}
+
+	if body := fetch("/encoded", "Accept-Encoding", "gzip"); body != "gzip" {
+		t.Errorf("Expected the gzip variant, got %q", body)
+	}
+	if body := fetch("/encoded", "Accept-Encoding", "identity"); body != "identity" {
+		t.Errorf("Expected the identity variant rather than the cached gzip one, got %q", body)
+	}
+	fetch("/encoded", "Accept-Encoding", "gzip")
+	if hits != 2 {
+		t.Errorf("Expected each encoding cached separately, got %d backend hits", hits)
+	}
+
+	atomic.StoreInt64(&hits, 0)
+	if body := fetch("/personal", "Cookie", "session=alice"); body != "session=alice" {
+		t.Errorf("Expected alice's response, got %q", body)
+	}
+	if body := fetch("/personal", "Cookie", "session=bob"); body != "session=bob" {
+		t.Errorf("Expected bob's own response, got %q", body)
+	}
+	fetch("/personal", "X-Anonymous", "1")
+	fetch("/personal", "X-Anonymous", "1")
+	if hits != 4 {
+		t.Errorf("Expected requests with cookies and responses varying on Cookie to skip the cache, got %d backend hits", hits)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "net/http"
+
+const DefaultCanaryHeader = "X-Canary"
+
+// isCanary reports whether req asked for the canary: its CanaryHeader is set
+// to CanaryValue, or to anything when no value is configured.
+func (p *Proxy) isCanary(req *http.Request) bool {
+	if p.Canary == nil {
+		return false
+	}
+	header := p.CanaryHeader
+	if header == "" {
+		header = DefaultCanaryHeader
+	}
+	value := req.Header.Get(header)
+	if p.CanaryValue == "" {
+		return value != ""
+	}
+	return value == p.CanaryValue
+}
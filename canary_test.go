@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCanaryByHeader(t *testing.T) {
+	urls, closeAll := namedBackends(t, "stable", "canary")
+	defer closeAll()
+
+	app := Subject()
+	app.RegisterWithOptions(urls[0], "app", ProxyOptions{CanaryTarget: urls[1], CanaryValue: "true"})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	cases := map[string]string{"": "stable", "true": "canary", "false": "stable"}
+	for value, expected := range cases {
+		req, _ := http.NewRequest("GET", server.URL+"/proxy/app/", nil)
+		if value != "" {
+			req.Header.Set("X-Canary", value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != expected {
+			t.Errorf("Expected X-Canary %q to hit %s, got %s", value, expected, body)
+		}
+	}
+}
+
+func TestCanaryWithCache(t *testing.T) {
+	urls, closeAll := namedBackends(t, "stable", "canary")
+	defer closeAll()
+
+	app := Subject()
+	app.RegisterWithOptions(urls[0], "app", ProxyOptions{CanaryTarget: urls[1], CacheTTL: time.Minute})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	for _, value := range []string{"", "1", ""} {
+		expected := "stable"
+		req, _ := http.NewRequest("GET", server.URL+"/proxy/app/", nil)
+		if value != "" {
+			req.Header.Set("X-Canary", value)
+			expected = "canary"
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != expected {
+			t.Errorf("Expected X-Canary %q to get the %s response, got %s", value, expected, body)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/url"
+)
+
+// setClientCertHeaders passes the verified client certificate to the upstream.
+// Incoming values are always dropped so clients can't forge them.
+func setClientCertHeaders(req *http.Request) {
+	req.Header.Del("X-Client-Cert")
+	req.Header.Del("X-Client-Cert-Subject")
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return
+	}
+	cert := req.TLS.PeerCertificates[0]
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	req.Header.Set("X-Client-Cert", url.QueryEscape(string(encoded)))
+	req.Header.Set("X-Client-Cert-Subject", cert.Subject.String())
+}
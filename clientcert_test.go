@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newClientCert(t *testing.T, commonName string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertForwarding(t *testing.T) {
+	var subject, cert string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = r.Header.Get("X-Client-Cert-Subject")
+		cert = r.Header.Get("X-Client-Cert")
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "mtls")
+	server := httptest.NewUnstartedServer(app.Router)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{newClientCert(t, "client.example")}
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/mtls/", nil)
+	req.Header.Set("X-Client-Cert-Subject", "CN=forged")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+
+	if subject != "CN=client.example" {
+		t.Errorf("Expected subject CN=client.example, got %s", subject)
+	}
+	if cert == "" {
+		t.Error("Expected the client certificate to be forwarded")
+	}
+}
+
+func TestClientCertHeadersStrippedWithoutTLS(t *testing.T) {
+	var subject string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = r.Header.Get("X-Client-Cert-Subject")
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "plain")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/plain/", nil)
+	req.Header.Set("X-Client-Cert-Subject", "CN=forged")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if subject != "" {
+		t.Errorf("Expected forged subject to be stripped, got %s", subject)
+	}
+}
+
+func TestClientCAVerifiesClientCerts(t *testing.T) {
+	var subject string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = r.Header.Get("X-Client-Cert-Subject")
+	}))
+	defer backend.Close()
+
+	trusted := newClientCert(t, "trusted.example")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: trusted.Certificate[0]})
+	config, err := listenConfig{ClientCAFile: writeConfig(t, string(ca))}.tlsConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	app := Subject()
+	app.Register(backend.URL, "mtls")
+	server := httptest.NewUnstartedServer(app.Router)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	// get always sends cert, even one the server's CA list doesn't ask for,
+	// so it is the server that has to reject it.
+	get := func(cert *tls.Certificate) (*http.Response, error) {
+		client := server.Client()
+		transport := client.Transport.(*http.Transport)
+		transport.CloseIdleConnections()
+		transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		}
+		return client.Get(server.URL + "/proxy/mtls/")
+	}
+
+	res, err := get(&trusted)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if subject != "CN=trusted.example" {
+		t.Errorf("Expected subject CN=trusted.example, got %s", subject)
+	}
+
+	subject = ""
+	res, err = get(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || subject != "" {
+		t.Errorf("Expected clients without a certificate to be let through without one, got %d %q", res.StatusCode, subject)
+	}
+
+	untrusted := newClientCert(t, "untrusted.example")
+	if res, err := get(&untrusted); err == nil {
+		res.Body.Close()
+		t.Error("Expected a certificate from an unknown CA to be rejected")
+	}
+}
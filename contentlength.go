@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// ContentLengthPolicy controls how responses are framed when forwarded.
+type ContentLengthPolicy int
+
+const (
+	// ContentLengthPassthrough forwards responses framed as the upstream sent them.
+	ContentLengthPassthrough ContentLengthPolicy = iota
+	// ContentLengthBuffer buffers responses without a Content-Length, up to
+	// ContentLengthLimit bytes, so one can be set.
+	ContentLengthBuffer
+	// ContentLengthChunked drops the Content-Length so responses are always chunked.
+	ContentLengthChunked
+)
+
+const DefaultContentLengthLimit = 1 << 20
+
+func (p *Proxy) applyContentLength(res *http.Response) error {
+	switch p.ContentLength {
+	case ContentLengthBuffer:
+		if res.ContentLength >= 0 {
+			return nil
+		}
+		limit := p.ContentLengthLimit
+		if limit <= 0 {
+			limit = DefaultContentLengthLimit
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(res.Body, limit+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) > limit {
+			// Too large to buffer, stream the rest as it comes.
+			res.Body = readCloser{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+			return nil
+		}
+		res.Body.Close()
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		res.ContentLength = int64(len(body))
+		res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	case ContentLengthChunked:
+		res.ContentLength = -1
+		res.Header.Del("Content-Length")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func chunkedBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+	}))
+}
+
+func fetch(t *testing.T, url string) *http.Response {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestContentLengthPolicies(t *testing.T) {
+	backend := chunkedBackend()
+	defer backend.Close()
+	fixed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fixed length body"))
+	}))
+	defer fixed.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "passthrough")
+	app.RegisterWithOptions(backend.URL, "buffered", ProxyOptions{ContentLength: ContentLengthBuffer})
+	app.RegisterWithOptions(backend.URL, "capped", ProxyOptions{ContentLength: ContentLengthBuffer, ContentLengthLimit: 4})
+	app.RegisterWithOptions(fixed.URL, "chunked", ProxyOptions{ContentLength: ContentLengthChunked})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if res := fetch(t, server.URL+"/proxy/passthrough/"); res.ContentLength != -1 {
+		t.Errorf("Expected a chunked response, got Content-Length %d", res.ContentLength)
+	}
+	if res := fetch(t, server.URL+"/proxy/buffered/"); res.ContentLength != int64(len("hello world")) {
+		t.Errorf("Expected Content-Length %d, got %d", len("hello world"), res.ContentLength)
+	}
+	if res := fetch(t, server.URL+"/proxy/capped/"); res.ContentLength != -1 {
+		t.Errorf("Expected a response over the cap to stream, got Content-Length %d", res.ContentLength)
+	}
+	if content := get(t, server.URL+"/proxy/capped/"); content != "hello world" {
+		t.Errorf("Expected the full body, got %s", content)
+	}
+	if res := fetch(t, server.URL+"/proxy/chunked/"); res.ContentLength != -1 {
+		t.Errorf("Expected a forced chunked response, got Content-Length %d", res.ContentLength)
+	}
+}
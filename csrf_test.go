@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestUnregisterNeedsPostAndCSRFToken(t *testing.T) {
+	app := Subject()
+	app.Register("http://localhost:9000", "doomed")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	res, err := client.Get(server.URL + "/unregister?path=doomed")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for GET, got %d", http.StatusMethodNotAllowed, res.StatusCode)
+	}
+
+	res, err = client.PostForm(server.URL+"/unregister", url.Values{"path": {"doomed"}, "csrf_token": {"forged"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status %d without a valid token, got %d", http.StatusForbidden, res.StatusCode)
+	}
+	if _, err := app.Find("doomed"); err != nil {
+		t.Fatalf("Expected the proxy to survive, got %s", err)
+	}
+
+	res, err = client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	match := regexp.MustCompile(`name="csrf_token" value="([0-9a-f]+)"`).FindSubmatch(content)
+	if match == nil {
+		t.Fatalf("Expected a CSRF token in the page, got %s", content)
+	}
+
+	res, err = client.PostForm(server.URL+"/unregister", url.Values{"path": {"doomed"}, "csrf_token": {string(match[1])}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected to be redirected to the index, got %d", res.StatusCode)
+	}
+	if _, err := app.Find("doomed"); err == nil {
+		t.Errorf("Expected the proxy to be unregistered")
+	}
+}
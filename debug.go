@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+const DefaultDebugBodyLimit = 1024
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// debugBodyType reports whether the request's content type is one the proxy
+// wants logged. An empty list matches everything.
+func (p *Proxy) debugBodyType(r *http.Request) bool {
+	if len(p.DebugBodyTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range p.DebugBodyTypes {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// logRequestBody logs up to DebugBodyLimit bytes of the request body. Only the
+// logged prefix is buffered; it is stitched back in front of the rest of the
+// body so the upstream receives it unchanged.
+func (app *App) logRequestBody(proxy *Proxy, r *http.Request) {
+	if r.Body == nil || !proxy.debugBodyType(r) {
+		return
+	}
+	limit := proxy.DebugBodyLimit
+	if limit <= 0 {
+		limit = DefaultDebugBodyLimit
+	}
+	prefix, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+	if err != nil {
+		app.Logger.Printf("debug body proxy=%s error=%q", proxy.Path, err)
+		return
+	}
+	suffix := ""
+	if len(prefix) > limit {
+		prefix = prefix[:limit]
+		suffix = "..."
+	}
+	app.Logger.Printf("debug body proxy=%s method=%s path=%s body=%q%s", proxy.Path, r.Method, r.URL.Path, prefix, suffix)
+}
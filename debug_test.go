@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugBodyLogging(t *testing.T) {
+	var received []byte
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer backend.Close()
+
+	var logged bytes.Buffer
+	app := Subject()
+	app.Logger = log.New(&logged, "", 0)
+	app.RegisterWithOptions(backend.URL, "debug", ProxyOptions{
+		DebugBody:      true,
+		DebugBodyTypes: []string{"application/json"},
+		DebugBodyLimit: 8,
+	})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	body := `{"name":"reverser"}`
+	res, err := http.Post(server.URL+"/proxy/debug/", "application/json; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+
+	if string(received) != body {
+		t.Errorf("Expected backend to receive %s, got %s", body, received)
+	}
+	if !strings.Contains(logged.String(), `body="{\"name\":"...`) {
+		t.Errorf("Expected truncated body in log, got %s", logged.String())
+	}
+
+	logged.Reset()
+	res, err = http.Post(server.URL+"/proxy/debug/", "text/plain", strings.NewReader("plain"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if logged.Len() != 0 {
+		t.Errorf("Expected unconfigured content type not to be logged, got %s", logged.String())
+	}
+}
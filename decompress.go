@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDecompressedBytes caps decoded request bodies for proxies that
+// don't set MaxDecompressedBytes.
+const DefaultMaxDecompressedBytes = 10 << 20
+
+var errDecompressedTooLarge = errors.New("decompressed request body is too large")
+
+// decompressRequest replaces a gzip encoded request body with its decoded
+// content. The body is decoded up front, at most limit bytes of it, so a
+// small payload can't expand without bound and the decoded length can be
+// sent upstream. Past limit it fails with errDecompressedTooLarge.
+func decompressRequest(r *http.Request, limit int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "x-gzip" {
+		return nil
+	}
+	reader, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > limit {
+		return errDecompressedTooLarge
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.Header.Del("Content-Encoding")
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	r.ContentLength = int64(len(body))
+	return nil
+}
+
+// decompressLimit is the proxy's MaxDecompressedBytes, or the default.
+func (p *Proxy) decompressLimit() int64 {
+	if p.MaxDecompressedBytes > 0 {
+		return p.MaxDecompressedBytes
+	}
+	return DefaultMaxDecompressedBytes
+}
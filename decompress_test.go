@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecompressRequest(t *testing.T) {
+	var received []byte
+	var encoding string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "gzip", ProxyOptions{DecompressRequest: true})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("plain text payload"))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/proxy/gzip/", &compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+
+	if string(received) != "plain text payload" {
+		t.Errorf("Expected the decompressed body, got %q", received)
+	}
+	if encoding != "" {
+		t.Errorf("Expected Content-Encoding to be removed, got %s", encoding)
+	}
+
+	req, _ = http.NewRequest("POST", server.URL+"/proxy/gzip/", bytes.NewReader([]byte("not gzip")))
+	req.Header.Set("Content-Encoding", "gzip")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a corrupt body, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestDecompressRequestLimit(t *testing.T) {
+	var received int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = len(body)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "gzip", ProxyOptions{DecompressRequest: true, MaxDecompressedBytes: 1024})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	post := func(size int) *http.Response {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		writer.Write(make([]byte, size))
+		writer.Close()
+		req, _ := http.NewRequest("POST", server.URL+"/proxy/gzip/", &compressed)
+		req.Header.Set("Content-Encoding", "gzip")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	if res := post(1024); res.StatusCode != http.StatusOK || received != 1024 {
+		t.Errorf("Expected a body at the limit to be forwarded, got %d with %d bytes", res.StatusCode, received)
+	}
+	received = 0
+	if res := post(1 << 20); res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for a body over the limit, got %d", http.StatusRequestEntityTooLarge, res.StatusCode)
+	}
+	if received != 0 {
+		t.Errorf("Expected nothing forwarded for a body over the limit, got %d bytes", received)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// minAddrTimeout is the least time an address gets when the dial timeout is
+// shared out between several, as net.Dialer does.
+const minAddrTimeout = 2 * time.Second
+
+// errNoAddresses is returned when a host resolves to no addresses at all.
+var errNoAddresses = errors.New("no addresses to dial")
+
+// Dialer dials upstream connections. When a host resolves to both IPv6 and
+// IPv4 addresses it races the two families ("happy eyeballs"): addresses of
+// the first family are tried first, and if none has connected after
+// FallbackDelay the other family is tried alongside. The first connection
+// wins, so an unreachable family costs at most FallbackDelay. The embedded
+// dialer's Timeout bounds the whole dial, lookup and every address included,
+// not each attempt.
+type Dialer struct {
+	*net.Dialer
+	FallbackDelay time.Duration
+
+	// Lookup resolves host names, net.DefaultResolver when nil.
+	Lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+func (d *Dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || network != "tcp" || net.ParseIP(host) != nil {
+		return d.Dialer.DialContext(ctx, network, address)
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	lookup := d.Lookup
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupIPAddr
+	}
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	primaries, fallbacks := splitFamilies(addrs)
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, primaries, port)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan dialResult, 2)
+	dial := func(addrs []net.IPAddr) {
+		go func() {
+			conn, err := d.dialSerial(ctx, addrs, port)
+			results <- dialResult{conn, err}
+		}()
+	}
+	dial(primaries)
+	pending := 1
+	fallback := time.NewTimer(d.FallbackDelay)
+	defer fallback.Stop()
+	var firstErr error
+	for {
+		select {
+		case <-fallback.C:
+			if fallbacks != nil {
+				dial(fallbacks)
+				fallbacks = nil
+				pending++
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if pending > 0 {
+					// The loser is cancelled, but may have connected already.
+					go func() {
+						if res := <-results; res.conn != nil {
+							res.conn.Close()
+						}
+					}()
+				}
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if fallbacks != nil {
+				// No point waiting out the delay once the first family failed.
+				dial(fallbacks)
+				fallbacks = nil
+				pending++
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// dialSerial tries addrs in order, returning the first connection made. The
+// time left before ctx's deadline is shared out between the addresses, so
+// one that hangs can't use up the time of those after it.
+func (d *Dialer) dialSerial(ctx context.Context, addrs []net.IPAddr, port string) (net.Conn, error) {
+	if len(addrs) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errNoAddresses}
+	}
+	var err error
+	for i, addr := range addrs {
+		var conn net.Conn
+		conn, err = d.dialAddr(ctx, net.JoinHostPort(addr.String(), port), len(addrs)-i)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// dialAddr dials address with its share of the time left, out of remaining
+// addresses.
+func (d *Dialer) dialAddr(ctx context.Context, address string, remaining int) (net.Conn, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok || remaining <= 1 {
+		return d.Dialer.DialContext(ctx, "tcp", address)
+	}
+	left := time.Until(deadline)
+	share := left / time.Duration(remaining)
+	if share < minAddrTimeout {
+		share = minAddrTimeout
+		if left < share {
+			share = left
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, share)
+	defer cancel()
+	return d.Dialer.DialContext(ctx, "tcp", address)
+}
+
+// splitFamilies splits addrs into those of the first address's family and
+// the rest.
+func splitFamilies(addrs []net.IPAddr) (primaries []net.IPAddr, fallbacks []net.IPAddr) {
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) == (addrs[0].IP.To4() != nil) {
+			primaries = append(primaries, addr)
+		} else {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+	return primaries, fallbacks
+}
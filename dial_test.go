@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSplitFamilies(t *testing.T) {
+	addrs := []net.IPAddr{{IP: net.ParseIP("::1")}, {IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("fe80::1")}}
+	primaries, fallbacks := splitFamilies(addrs)
+	if len(primaries) != 2 || len(fallbacks) != 1 || !fallbacks[0].IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("Expected IPv6 primaries and an IPv4 fallback, got %v and %v", primaries, fallbacks)
+	}
+}
+
+func TestDialerFallsBackToReachableFamily(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dual stack"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	dialer := NewDialer(DefaultKeepAlive)
+	dialer.FallbackDelay = 50 * time.Millisecond
+	dialer.Lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		// 100::/64 is a discard prefix, so the IPv6 address never connects.
+		return []net.IPAddr{{IP: net.ParseIP("100::1")}, {IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+
+	start := time.Now()
+	res, err := (&http.Client{Transport: NewTransport(dialer)}).Get("http://dual.test:" + port + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the IPv4 fallback to connect quickly, took %s", elapsed)
+	}
+}
+
+func TestDialerAllFamiliesFail(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	dialer := NewDialer(DefaultKeepAlive)
+	dialer.FallbackDelay = 50 * time.Millisecond
+	dialer.Lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("::1")}}, nil
+	}
+	if _, err := dialer.DialContext(context.Background(), "tcp", "closed.test:"+port); err == nil {
+		t.Error("Expected an error when no address connects")
+	}
+}
+
+func TestDialerNoAddresses(t *testing.T) {
+	dialer := NewDialer(DefaultKeepAlive)
+	dialer.Lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{}, nil
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", "empty.test:80")
+	if conn != nil || err == nil {
+		t.Fatalf("Expected an error dialing a host without addresses, got %v", conn)
+	}
+	if opErr, ok := err.(*net.OpError); !ok || opErr.Err != errNoAddresses {
+		t.Errorf("Expected %s, got %s", errNoAddresses, err)
+	}
+}
+
+func TestDialerTimeoutCoversEveryAddress(t *testing.T) {
+	dialer := NewDialer(DefaultKeepAlive)
+	dialer.Timeout = 200 * time.Millisecond
+	dialer.Lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		// 100::/64 is a discard prefix, so none of these ever connects.
+		return []net.IPAddr{{IP: net.ParseIP("100::1")}, {IP: net.ParseIP("100::2")}, {IP: net.ParseIP("100::3")}}, nil
+	}
+
+	start := time.Now()
+	if _, err := dialer.DialContext(context.Background(), "tcp", "blackhole.test:80"); err == nil {
+		t.Fatal("Expected an error when no address connects")
+	}
+	if elapsed := time.Since(start); elapsed > 2*dialer.Timeout {
+		t.Errorf("Expected the dial to give up after %s in total, took %s", dialer.Timeout, elapsed)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// Endpoint is a route reverser serves. Methods is empty when any method is
+// accepted.
+type Endpoint struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+// Endpoints lists every route mounted on the router, sorted by path. It is
+// read from the router itself so it can't drift from what is served. Routes
+// registered once per method are merged into one endpoint.
+func (app *App) Endpoints() []Endpoint {
+	byPath := make(map[string]*Endpoint)
+	app.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		endpoint, ok := byPath[path]
+		if !ok {
+			endpoint = &Endpoint{Path: path, Methods: []string{}}
+			byPath[path] = endpoint
+		}
+		methods, _ := route.GetMethods()
+		endpoint.Methods = append(endpoint.Methods, methods...)
+		return nil
+	})
+	endpoints := make([]Endpoint, 0, len(byPath))
+	for _, endpoint := range byPath {
+		sort.Strings(endpoint.Methods)
+		endpoints = append(endpoints, *endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Path < endpoints[j].Path
+	})
+	return endpoints
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndpointRegistry(t *testing.T) {
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	req.Header.Set("Accept", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	var body struct {
+		Endpoints []Endpoint `json:"endpoints"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	endpoints := make(map[string][]string)
+	for _, endpoint := range body.Endpoints {
+		endpoints[endpoint.Path] = endpoint.Methods
+	}
+	for _, path := range []string{"/", "/register", "/unregister", "/api/proxies", "/api/proxies/{path}", "/metrics"} {
+		if _, ok := endpoints[path]; !ok {
+			t.Errorf("Expected %s in the endpoint list, got %v", path, body.Endpoints)
+		}
+	}
+	if methods := endpoints["/api/proxies"]; len(methods) != 2 || methods[0] != "GET" || methods[1] != "POST" {
+		t.Errorf("Expected /api/proxies to accept GET and POST, got %v", methods)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var targetVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ExpandTarget replaces ${NAME} in target with the environment variable NAME,
+// or with fallback for ${NAME:-fallback} when NAME is unset or empty. A
+// variable that is unset with no fallback is an error.
+func ExpandTarget(target string) (string, error) {
+	return expandTarget(target, os.LookupEnv)
+}
+
+func expandTarget(target string, lookup func(string) (string, bool)) (string, error) {
+	var missing string
+	expanded := targetVariable.ReplaceAllStringFunc(target, func(reference string) string {
+		match := targetVariable.FindStringSubmatch(reference)
+		value, ok := lookup(match[1])
+		if match[2] != "" && value == "" {
+			return match[3]
+		}
+		if !ok && missing == "" {
+			missing = match[1]
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("target %s uses unset environment variable %s", target, missing)
+	}
+	return expanded, nil
+}
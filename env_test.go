@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExpandTarget(t *testing.T) {
+	env := map[string]string{"BACKEND_HOST": "backend", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	cases := map[string]string{
+		"http://${BACKEND_HOST}:8080":                 "http://backend:8080",
+		"http://${MISSING:-fallback}:8080":            "http://fallback:8080",
+		"http://${EMPTY:-fallback}":                   "http://fallback",
+		"http://${BACKEND_HOST:-fallback}/a,http://b": "http://backend/a,http://b",
+		"http://plain/$notavariable":                  "http://plain/$notavariable",
+	}
+	for target, expected := range cases {
+		expanded, err := expandTarget(target, lookup)
+		if err != nil {
+			t.Errorf("Unexpected error %s", err)
+		}
+		if expanded != expected {
+			t.Errorf("Expected %s to expand to %s, got %s", target, expected, expanded)
+		}
+	}
+
+	if _, err := expandTarget("http://${MISSING}:8080", lookup); err == nil || !strings.Contains(err.Error(), "MISSING") {
+		t.Errorf("Expected an error naming the unset variable, got %v", err)
+	}
+}
+
+func TestRegisterExpandsTarget(t *testing.T) {
+	app := Subject()
+	if err := app.Register("http://${REVERSER_TEST_UNSET_HOST}:8080", "missing"); err == nil {
+		t.Errorf("Expected an error registering a target with an unset variable")
+	}
+	if _, err := app.Find("missing"); err == nil {
+		t.Errorf("Expected nothing to be registered")
+	}
+
+	proxy, err := app.RegisterProxy("http://${REVERSER_TEST_UNSET_HOST:-localhost}:8080", "fallback")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy.URL.String() != "http://localhost:8080" {
+		t.Errorf("Expected the fallback to be used, got %s", proxy.URL)
+	}
+
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	res, err := http.PostForm(server.URL+"/register", url.Values{"path": {"form"}, "target": {"http://${REVERSER_TEST_UNSET_HOST}"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(content), "unset environment variable REVERSER_TEST_UNSET_HOST") {
+		t.Errorf("Expected the form to show the unset variable, got %s", content)
+	}
+
+	req, _ := http.NewRequest("POST", server.URL+"/api/import", strings.NewReader(`{"proxies":[{"path":"imported","target":"http://${REVERSER_TEST_UNSET_HOST}"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	if res := status(t, req); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d importing an unset variable, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestFormsExpandTargetOnce(t *testing.T) {
+	os.Setenv("REVERSER_TEST_TARGET", "http://backend:8080/${REVERSER_TEST_UNSET_HOST}")
+	defer os.Unsetenv("REVERSER_TEST_TARGET")
+
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	res, err := http.PostForm(server.URL+"/register", url.Values{"path": {"form"}, "target": {"${REVERSER_TEST_TARGET}"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	proxy, err := app.Find("form")
+	if err != nil {
+		t.Fatalf("Expected the form to register the proxy, got %s", err)
+	}
+	if proxy.URL.Path != "/${REVERSER_TEST_UNSET_HOST}" {
+		t.Errorf("Expected the variable's value to be kept as is, got %s", proxy.URL.Path)
+	}
+
+	app.Register("http://backend:8080", "edited")
+	res, err = http.PostForm(server.URL+"/edit?path=edited", url.Values{"target": {"${REVERSER_TEST_TARGET}"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if proxy, _ := app.Find("edited"); proxy.URL.Path != "/${REVERSER_TEST_UNSET_HOST}" {
+		t.Errorf("Expected the edit to keep the variable's value as is, got %s", proxy.URL.Path)
+	}
+}
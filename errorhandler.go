@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// StatusClientClosedRequest is nginx's status for requests the client gave up
+// on before the upstream answered. Nobody sees it but the logs and stats.
+const StatusClientClosedRequest = 499
+
+// proxyErrorHandler handles upstream failures for a proxy. Before the response
+// has started the client gets an error page: 502 when the upstream couldn't be
+// reached, 504 when it timed out and 499 when the client went away. Once a
+// status has been sent it can no longer be replaced, so the error is logged
+// and the connection aborted, which the client sees as a truncated response
+// rather than an error page spliced into the body.
+func (app *App) proxyErrorHandler(proxy *Proxy) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		sw, ok := w.(*statusWriter)
+		if ok {
+			sw.err = err
+		}
+		if ok && sw.wroteHeader {
+			app.Logger.Printf("proxy %s: upstream failed after %d bytes of response: %s", proxy.Path, sw.bytes, err)
+			panic(http.ErrAbortHandler)
+		}
+		app.Logger.Printf("proxy %s: upstream failed: %s", proxy.Path, err)
+		switch {
+		case errors.Is(err, context.Canceled) || errors.Is(r.Context().Err(), context.Canceled):
+			w.WriteHeader(StatusClientClosedRequest)
+		case errors.Is(err, context.DeadlineExceeded) || errors.Is(r.Context().Err(), context.DeadlineExceeded) || timedOut(err):
+			http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+		case errors.Is(err, errIdempotencyInFlight):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, errRedirectLoop):
+			http.Error(w, http.StatusText(http.StatusLoopDetected), http.StatusLoopDetected)
+		default:
+			app.renderBadGateway(w, proxy)
+		}
+	}
+}
+
+func (app *App) renderBadGateway(w http.ResponseWriter, proxy *Proxy) {
+	viewContext := NewViewContext()
+	viewContext["Title"] = "reverser-bad-gateway"
+	viewContext["Path"] = proxy.Path
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadGateway)
+	app.ExecuteTemplate(w, "502.html", viewContext)
+}
+
+// timedOut reports whether err is a network timeout, such as the transport
+// giving up waiting for response headers.
+func timedOut(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorHandlerBeforeResponse(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	app := Subject()
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.Register(down.URL, "down")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/proxy/down/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, res.StatusCode)
+	}
+	if !strings.Contains(string(body), "Bad gateway") {
+		t.Errorf("Expected the 502 page, got %s", body)
+	}
+}
+
+func TestErrorHandlerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	app := Subject()
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.RegisterWithOptions(slow.URL, "slow", ProxyOptions{ProxyDefaults: ProxyDefaults{Timeout: 50 * time.Millisecond}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/proxy/slow/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, res.StatusCode)
+	}
+}
+
+func TestErrorHandlerClientGone(t *testing.T) {
+	app := Subject()
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.Register("http://localhost:9000", "gone")
+	proxy, _ := app.Find("gone")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	app.proxyErrorHandler(proxy)(recorder, req, context.Canceled)
+
+	if recorder.Code != StatusClientClosedRequest {
+		t.Errorf("Expected status %d, got %d", StatusClientClosedRequest, recorder.Code)
+	}
+}
+
+func TestErrorHandlerMidStream(t *testing.T) {
+	var logged bytes.Buffer
+	app := Subject()
+	app.Logger = log.New(&logged, "", 0)
+	app.Register("http://localhost:9000", "streaming")
+	proxy, _ := app.Find("streaming")
+
+	recorder := httptest.NewRecorder()
+	w := &statusWriter{ResponseWriter: recorder}
+	w.Write([]byte("partial"))
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != http.ErrAbortHandler {
+				t.Errorf("Expected the handler to abort, got %v", recovered)
+			}
+		}()
+		app.proxyErrorHandler(proxy)(w, httptest.NewRequest("GET", "/", nil), errors.New("connection reset"))
+	}()
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status to stay %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if recorder.Body.String() != "partial" {
+		t.Errorf("Expected no error text after the partial body, got %q", recorder.Body.String())
+	}
+	if !strings.Contains(logged.String(), "connection reset") {
+		t.Errorf("Expected the failure to be logged, got %s", logged.String())
+	}
+}
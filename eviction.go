@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EvictionPolicy sets what a Store does when registering would take it past
+// MaxProxies.
+type EvictionPolicy int
+
+const (
+	// EvictReject refuses the new proxy.
+	EvictReject EvictionPolicy = iota
+	// EvictLRU unregisters the least recently used proxy to make room.
+	EvictLRU
+)
+
+var ErrStoreFull = errors.New("proxy limit reached")
+
+// ParseEvictionPolicy parses "reject" or "lru".
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "reject":
+		return EvictReject, nil
+	case "lru":
+		return EvictLRU, nil
+	}
+	return EvictReject, fmt.Errorf("unknown eviction policy %q", name)
+}
+
+// touch marks path as just used. The lock must be held.
+func (s *Store) touch(path string) {
+	s.clock++
+	s.accessed[path] = s.clock
+}
+
+// makeRoom ensures registering path stays within MaxProxies, evicting or
+// refusing as the policy says. The lock must be held.
+func (s *Store) makeRoom(path string) error {
+	if s.MaxProxies <= 0 {
+		return nil
+	}
+	if _, ok := s.store[path]; ok {
+		return nil
+	}
+	for len(s.store) >= s.MaxProxies {
+		if s.Eviction != EvictLRU {
+			return fmt.Errorf("%d proxies registered: %w", len(s.store), ErrStoreFull)
+		}
+		oldest := ""
+		for candidate := range s.store {
+			if oldest == "" || s.accessed[candidate] < s.accessed[oldest] {
+				oldest = candidate
+			}
+		}
+		evicted := s.store[oldest]
+		s.drop(oldest)
+		s.removed(evicted, RemovedByEviction)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStoreRejectsPastMaxProxies(t *testing.T) {
+	store := NewStore()
+	store.MaxProxies = 2
+	store.Register("http://a.example.com", "a")
+	store.Register("http://b.example.com", "b")
+
+	if err := store.Register("http://c.example.com", "c"); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("Expected ErrStoreFull, got %v", err)
+	}
+	if err := store.Update("http://a2.example.com", "a"); err != nil {
+		t.Errorf("Expected updating an existing path to succeed, got %s", err)
+	}
+}
+
+func TestStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewStore()
+	store.MaxProxies = 3
+	store.Eviction = EvictLRU
+	for _, path := range []string{"a", "b", "c"} {
+		store.Register("http://"+path+".example.com", path)
+	}
+	store.Find("a")
+	store.Find("c")
+
+	if err := store.Register("http://d.example.com", "d"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if _, err := store.Find("b"); err == nil {
+		t.Error("Expected the least recently used proxy to be evicted")
+	}
+	for _, path := range []string{"a", "c", "d"} {
+		if _, err := store.Find(path); err != nil {
+			t.Errorf("Expected %s to be kept, got %s", path, err)
+		}
+	}
+	if len(store.ProxyList()) != 3 {
+		t.Errorf("Expected 3 proxies, got %d", len(store.ProxyList()))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const DefaultSweepInterval = time.Minute
+
+// Expired reports whether the proxy's ExpiresAt has passed. Proxies without
+// one never expire.
+func (p *Proxy) Expired(now time.Time) bool {
+	return !p.ExpiresAt.IsZero() && !now.Before(p.ExpiresAt)
+}
+
+// SweepExpired unregisters every expired proxy.
+func (app *App) SweepExpired() {
+	now := time.Now()
+	for path, proxy := range app.ProxyList() {
+		if proxy.Expired(now) && app.Unregister(path) == nil {
+			app.AuditSystem("expire", path, proxy.Target(), "")
+		}
+	}
+}
+
+// StartExpirySweeper sweeps expired proxies every interval until stop is
+// closed. Requests for a proxy that expired since the last sweep get a 410.
+func (app *App) StartExpirySweeper(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				app.SweepExpired()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func renderGone(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpiredProxyStopsRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "demo", ProxyOptions{ExpiresAt: time.Now().Add(100 * time.Millisecond)})
+	app.Register(backend.URL, "permanent")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if res := fetch(t, server.URL+"/proxy/demo/"); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 before expiry, got %d", res.StatusCode)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if res := fetch(t, server.URL+"/proxy/demo/"); res.StatusCode != http.StatusGone {
+		t.Errorf("Expected 410 after expiry, got %d", res.StatusCode)
+	}
+
+	app.SweepExpired()
+	if _, err := app.Find("demo"); err == nil {
+		t.Error("Expected the sweeper to unregister the expired proxy")
+	}
+	if _, err := app.Find("permanent"); err != nil {
+		t.Errorf("Expected proxies without an expiry to be kept, got %s", err)
+	}
+}
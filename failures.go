@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultFailureLogSize = 100
+
+// Failure is a proxied request that ended in a 5xx or a transport error.
+type Failure struct {
+	Time   time.Time `json:"time"`
+	Proxy  string    `json:"proxy"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Target string    `json:"target"`
+	Status int       `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// FailureLog keeps the most recent failures in a fixed size ring.
+type FailureLog struct {
+	sync.Mutex
+	entries []Failure
+	next    int
+	full    bool
+}
+
+func NewFailureLog(size int) *FailureLog {
+	return &FailureLog{entries: make([]Failure, size)}
+}
+
+func (l *FailureLog) Add(f Failure) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.entries) == 0 {
+		return
+	}
+	l.entries[l.next] = f
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the logged failures, newest first.
+func (l *FailureLog) Recent() []Failure {
+	l.Lock()
+	defer l.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	recent := make([]Failure, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return recent
+}
+
+// recordFailure logs a proxied request that failed upstream, if the failure
+// log is enabled.
+func (app *App) recordFailure(proxy *Proxy, r *http.Request, sw *statusWriter) {
+	if app.Failures == nil || (sw.err == nil && sw.Status() < 500) {
+		return
+	}
+	f := Failure{
+		Time:   time.Now(),
+		Proxy:  proxy.Path,
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Target: proxy.URL.String(),
+		Status: sw.Status(),
+	}
+	if sw.err != nil {
+		f.Error = sw.err.Error()
+	}
+	app.Failures.Add(f)
+}
+
+func (app *App) MountFailureHandlers() {
+	app.HandleAPI("/api/failures", func(w http.ResponseWriter, r *http.Request) {
+		failures := []Failure{}
+		if app.Failures != nil {
+			failures = app.Failures.Recent()
+		}
+		writeJSON(w, http.StatusOK, failures)
+	}).Methods("GET")
+}
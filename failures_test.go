@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestFailureLog(t *testing.T) {
+	log := NewFailureLog(2)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		log.Add(Failure{Path: path})
+	}
+	recent := log.Recent()
+	if len(recent) != 2 || recent[0].Path != "/c" || recent[1].Path != "/b" {
+		t.Errorf("Expected the two newest failures, got %v", recent)
+	}
+}
+
+func TestFailuresEndpoint(t *testing.T) {
+	h := NewTestHarness(t, map[string]http.Handler{
+		"broken": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+		"down": http.NotFoundHandler(),
+		"fine": http.NotFoundHandler(),
+	})
+	h.App.Failures = NewFailureLog(10)
+	h.Backend("down").Close()
+
+	h.Get("/proxy/broken/boom")
+	h.Get("/proxy/down/")
+	h.Get("/proxy/fine/missing")
+
+	res, body := h.Get("/api/failures")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", res.StatusCode)
+	}
+	var failures []Failure
+	if err := json.Unmarshal([]byte(body), &failures); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(failures) != 2 {
+		t.Fatalf("Expected 2 failures, got %v", failures)
+	}
+	down, broken := failures[0], failures[1]
+	if down.Proxy != "down" || down.Status != http.StatusBadGateway || down.Error == "" {
+		t.Errorf("Expected a transport error for down, got %+v", down)
+	}
+	if broken.Proxy != "broken" || broken.Status != http.StatusInternalServerError || broken.Path != "/proxy/broken/boom" {
+		t.Errorf("Expected a 500 for broken, got %+v", broken)
+	}
+	if broken.Target != h.Backend("broken").URL {
+		t.Errorf("Expected target %s, got %s", h.Backend("broken").URL, broken.Target)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed assets/favicon.ico
+var favicon []byte
+
+// MountFavicon serves the bundled favicon. It is mounted ahead of the proxy
+// handler, so browsers asking for it never reach a proxy, even with proxies
+// mounted at the root.
+func (app *App) MountFavicon() {
+	app.Router.HandleFunc(app.Link("/favicon.ico"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/x-icon")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Write(favicon)
+	}).Methods("GET", "HEAD")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFaviconNeverProxied(t *testing.T) {
+	proxied := false
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	defer backend.Close()
+
+	app := NewApp(template.Must(LoadTemplates("")), NewStore(), WithProxyPrefix("/"))
+	app.Setup()
+	app.Register(backend.URL, "favicon.ico")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res := fetch(t, server.URL+"/favicon.ico")
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", res.StatusCode)
+	}
+	if contentType := res.Header.Get("Content-Type"); contentType != "image/x-icon" {
+		t.Errorf("Expected an image content type, got %s", contentType)
+	}
+	if res.ContentLength != int64(len(favicon)) || len(favicon) == 0 {
+		t.Errorf("Expected the bundled favicon, got %d bytes", res.ContentLength)
+	}
+	if proxied {
+		t.Error("Expected /favicon.ico not to be proxied")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// proxyJSON is how a proxy is serialized: its targets as the raw,
+// comma-separated string it was registered with.
+type proxyJSON struct {
+	Path    string       `json:"path"`
+	Target  string       `json:"target"`
+	Options ProxyOptions `json:"options"`
+}
+
+// Target is the proxy's targets as a comma-separated string.
+func (p *Proxy) Target() string {
+	targets := make([]string, len(p.Backends))
+	for i, backend := range p.Backends {
+		targets[i] = backend.String()
+	}
+	return strings.Join(targets, ",")
+}
+
+// MarshalJSON writes the proxy in full, secrets included, for the FileStore.
+// The API shows ProxyView instead.
+func (p *Proxy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(proxyJSON{Path: p.Path, Target: p.Target(), Options: p.ProxyOptions})
+}
+
+// UnmarshalJSON rebuilds the proxy as if it had just been registered.
+func (p *Proxy) UnmarshalJSON(data []byte) error {
+	var shadow proxyJSON
+	if err := json.Unmarshal(data, &shadow); err != nil {
+		return err
+	}
+	proxy, err := newProxy(shadow.Target, shadow.Path, shadow.Options)
+	if err != nil {
+		return err
+	}
+	*p = *proxy
+	return nil
+}
+
+// fileState is the content of a FileStore's file.
+type fileState struct {
+	Proxies map[string]*Proxy        `json:"proxies"`
+	Groups  map[string]ProxyDefaults `json:"groups"`
+}
+
+// FileStore is a Store that saves its proxies and groups to a JSON file after
+// every change, so they survive restarts.
+type FileStore struct {
+	*Store
+	path     string
+	saveLock sync.Mutex
+}
+
+// NewFileStore loads the store saved at path, creating the file when it
+// doesn't exist. A file that can't be parsed is an error, rather than being
+// overwritten.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{Store: NewStore(), path: path}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state fileState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("%s is corrupt: %s", path, err)
+	}
+	for name, defaults := range state.Groups {
+		s.Store.groups[name] = defaults
+	}
+	for path, proxy := range state.Proxies {
+		proxy.Path = path
+		s.Store.put(path, proxy)
+		s.Store.touch(path)
+	}
+	return s, nil
+}
+
+// Ping checks that the store's file is still there to save to.
+func (s *FileStore) Ping() error {
+	_, err := os.Stat(s.path)
+	return err
+}
+
+// save writes the store to a temporary file and renames it into place, so a
+// crash mid-write leaves the previous file intact.
+func (s *FileStore) save() error {
+	s.Store.Lock()
+	state := fileState{Proxies: make(map[string]*Proxy, len(s.Store.store)), Groups: make(map[string]ProxyDefaults, len(s.Store.groups))}
+	for path, proxy := range s.Store.store {
+		state.Proxies[path] = proxy
+	}
+	for name, defaults := range s.Store.groups {
+		state.Groups[name] = defaults
+	}
+	s.Store.Unlock()
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// persist saves the store after a change that succeeded.
+func (s *FileStore) persist(err error) error {
+	if err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileStore) Register(target string, path string) error {
+	return s.RegisterWithOptions(target, path, ProxyOptions{})
+}
+
+func (s *FileStore) RegisterWithOptions(target string, path string, opts ProxyOptions) error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	return s.persist(s.Store.RegisterWithOptions(target, path, opts))
+}
+
+func (s *FileStore) Update(target string, path string) error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	return s.persist(s.Store.Update(target, path))
+}
+
+func (s *FileStore) UpdateWithOptions(target string, path string, opts ProxyOptions) error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	return s.persist(s.Store.UpdateWithOptions(target, path, opts))
+}
+
+// RegisterGroup can't report a failed save; the next change saves again.
+func (s *FileStore) RegisterGroup(name string, defaults ProxyDefaults) {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	s.Store.RegisterGroup(name, defaults)
+	s.save()
+}
+
+func (s *FileStore) Unregister(path string) error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	return s.persist(s.Store.Unregister(path))
+}
+
+func (s *FileStore) Rename(oldPath string, newPath string) error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	return s.persist(s.Store.Rename(oldPath, newPath))
+}
+
+func (s *FileStore) ReplaceAll(proxies map[string]*Proxy) error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	return s.persist(s.Store.ReplaceAll(proxies))
+}
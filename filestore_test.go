@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStorePersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxies.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the file to be created, got %s", err)
+	}
+	store.RegisterGroup("internal", ProxyDefaults{Timeout: 3 * time.Second})
+	store.Register("http://one.example.com/base?x=1", "one")
+	store.RegisterWithOptions("http://a.example.com,http://b.example.com", "many", ProxyOptions{Group: "internal", Retries: 2, BalancerSpec: &BalancerSpec{Type: "failover"}})
+	store.Register("http://gone.example.com", "gone")
+	store.Unregister("gone")
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(reloaded.ProxyList()) != 2 {
+		t.Errorf("Expected 2 proxies after reload, got %d", len(reloaded.ProxyList()))
+	}
+	one, err := reloaded.Find("one")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if one.URL.String() != "http://one.example.com/base?x=1" || one.Stats == nil {
+		t.Errorf("Expected one to round trip, got %s", one.URL)
+	}
+	many, err := reloaded.Find("many")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if many.Target() != "http://a.example.com,http://b.example.com" || many.Retries != 2 || many.BalancerSpec == nil || many.BalancerSpec.Type != "failover" {
+		t.Errorf("Expected many's targets and options to round trip, got %s %+v", many.Target(), many.ProxyOptions)
+	}
+	if many.Timeout != 3*time.Second {
+		t.Errorf("Expected the group defaults to round trip, got %s", many.Timeout)
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxies.json")
+	ioutil.WriteFile(path, []byte(`{"proxies": {"one": `), 0644)
+
+	if _, err := NewFileStore(path); err == nil {
+		t.Error("Expected an error for a corrupt file")
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != `{"proxies": {"one": ` {
+		t.Errorf("Expected the corrupt file to be left alone, got %s", content)
+	}
+}
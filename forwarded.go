@@ -0,0 +1,16 @@
+package main
+
+import "net/http"
+
+// setForwardedHeaders tells the upstream how the client reached us; host is
+// the Host the client asked for. X-Forwarded-For isn't touched here:
+// httputil.ReverseProxy appends the client address to it after the Director
+// runs, keeping the values set by earlier proxies.
+func setForwardedHeaders(req *http.Request, host string) {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", host)
+}
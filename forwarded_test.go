@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "fwd")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/fwd/", nil)
+	req.Host = "public.example.com"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+
+	if forwardedFor := got.Get("X-Forwarded-For"); forwardedFor != "203.0.113.7, 127.0.0.1" {
+		t.Errorf("Expected the client address appended to X-Forwarded-For, got %q", forwardedFor)
+	}
+	if proto := got.Get("X-Forwarded-Proto"); proto != "http" {
+		t.Errorf("Expected X-Forwarded-Proto http, got %q", proto)
+	}
+	if host := got.Get("X-Forwarded-Host"); host != "public.example.com" {
+		t.Errorf("Expected X-Forwarded-Host public.example.com, got %q", host)
+	}
+}
+
+func TestForwardedProtoTLS(t *testing.T) {
+	var proto string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Header.Get("X-Forwarded-Proto")
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "fwd")
+	server := httptest.NewTLSServer(app.Router)
+	defer server.Close()
+
+	res, err := server.Client().Get(server.URL + "/proxy/fwd/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if proto != "https" {
+		t.Errorf("Expected X-Forwarded-Proto https, got %q", proto)
+	}
+}
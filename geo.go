@@ -0,0 +1,35 @@
+package main
+
+import "net/http"
+
+// CDNGeoHeaders maps the geo headers set by common CDNs to reverser's
+// normalized names, for use as a proxy's GeoHeaders.
+var CDNGeoHeaders = map[string]string{
+	"CF-IPCountry":              "X-Geo-Country",
+	"CloudFront-Viewer-Country": "X-Geo-Country",
+	"CloudFront-Viewer-City":    "X-Geo-City",
+	"CloudFront-Viewer-ASN":     "X-Geo-ASN",
+	"X-AppEngine-Country":       "X-Geo-Country",
+	"X-AppEngine-City":          "X-Geo-City",
+	"Fastly-Geo-Country-Code":   "X-Geo-Country",
+	"X-Client-Geo-Location":     "X-Geo-Location",
+}
+
+// geoHeaders reads the inbound headers named in GeoHeaders and returns their
+// values under the normalized names. Normalized headers the client sent
+// itself are dropped, so only the CDN can set them.
+func (p *Proxy) geoHeaders(header http.Header) map[string]string {
+	if len(p.GeoHeaders) == 0 {
+		return nil
+	}
+	for _, normalized := range p.GeoHeaders {
+		header.Del(normalized)
+	}
+	geo := make(map[string]string)
+	for inbound, normalized := range p.GeoHeaders {
+		if value := header.Get(inbound); value != "" {
+			geo[normalized] = value
+		}
+	}
+	return geo
+}
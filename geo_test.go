@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "geo", ProxyOptions{GeoHeaders: CDNGeoHeaders})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/geo/", nil)
+	req.Header.Set("CF-IPCountry", "NL")
+	req.Header.Set("X-Geo-City", "Spoofed")
+	status(t, req)
+
+	if country := got.Get("X-Geo-Country"); country != "NL" {
+		t.Errorf("Expected X-Geo-Country NL, got %q", country)
+	}
+	if city := got.Get("X-Geo-City"); city != "" {
+		t.Errorf("Expected a client supplied X-Geo-City to be dropped, got %q", city)
+	}
+}
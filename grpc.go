@@ -0,0 +1,127 @@
+//go:build grpc
+// +build grpc
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const grpcServiceName = "reverser.Proxies"
+
+// grpcService is the read-only gRPC API. It is described by hand with the
+// well-known protobuf types, so no generated code is needed:
+//
+//	service Proxies {
+//	  rpc ListProxies(google.protobuf.Empty) returns (google.protobuf.Struct);
+//	  rpc GetProxy(google.protobuf.StringValue) returns (google.protobuf.Struct);
+//	}
+//
+// Proxies come back in the JSON shape of GET /api/proxies and
+// GET /api/proxies/{path}, secrets redacted.
+var grpcService = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		grpcMethod("ListProxies", func() interface{} { return new(emptypb.Empty) }, (*App).grpcListProxies),
+		grpcMethod("GetProxy", func() interface{} { return new(wrapperspb.StringValue) }, (*App).grpcGetProxy),
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// grpcMethod adapts an App method to a unary gRPC handler.
+func grpcMethod(name string, newRequest func() interface{}, call func(*App, context.Context, interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := newRequest()
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, in interface{}) (interface{}, error) {
+				return call(srv.(*App), ctx, in)
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/" + name}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+// GRPCServer returns a gRPC server with the read-only API registered.
+func (app *App) GRPCServer() *grpc.Server {
+	server := grpc.NewServer()
+	server.RegisterService(&grpcService, app)
+	return server
+}
+
+// ServeGRPC serves the read-only gRPC API on addr.
+func (app *App) ServeGRPC(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return app.GRPCServer().Serve(listener)
+}
+
+func (app *App) grpcListProxies(ctx context.Context, in interface{}) (interface{}, error) {
+	if err := app.grpcAuthenticate(ctx); err != nil {
+		return nil, err
+	}
+	return grpcStruct(ProxyViews(app.ProxyList()))
+}
+
+func (app *App) grpcGetProxy(ctx context.Context, in interface{}) (interface{}, error) {
+	if err := app.grpcAuthenticate(ctx); err != nil {
+		return nil, err
+	}
+	proxy, err := app.Find(in.(*wrapperspb.StringValue).GetValue())
+	if err != nil {
+		return nil, grpcstatus.Error(codes.NotFound, err.Error())
+	}
+	return grpcStruct(NewProxyView(proxy))
+}
+
+// grpcAuthenticate checks the call's authorization metadata with the admin
+// Authenticator, as requireAuth does for the REST API.
+func (app *App) grpcAuthenticate(ctx context.Context) error {
+	if app.Authenticator == nil {
+		return nil
+	}
+	r := (&http.Request{Header: http.Header{}}).WithContext(ctx)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			r.Header.Add("Authorization", value)
+		}
+	}
+	if _, ok := app.Authenticator.Authenticate(r); !ok {
+		return grpcstatus.Error(codes.Unauthenticated, http.StatusText(http.StatusUnauthorized))
+	}
+	return nil
+}
+
+// grpcStruct converts a JSON view to a protobuf Struct.
+func grpcStruct(view interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(view)
+	if err != nil {
+		return nil, grpcstatus.Error(codes.Internal, err.Error())
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, grpcstatus.Error(codes.Internal, err.Error())
+	}
+	return structpb.NewStruct(fields)
+}
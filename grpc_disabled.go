@@ -0,0 +1,12 @@
+//go:build !grpc
+// +build !grpc
+
+package main
+
+import "errors"
+
+// ServeGRPC is only available when reverser is built with -tags grpc, which
+// pulls in google.golang.org/grpc.
+func (app *App) ServeGRPC(addr string) error {
+	return errors.New("-grpc-addr needs reverser built with -tags grpc")
+}
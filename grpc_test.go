@@ -0,0 +1,88 @@
+//go:build grpc
+// +build grpc
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func grpcSubject(t *testing.T, app *App) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := app.GRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCProxies(t *testing.T) {
+	app := Subject()
+	app.Register("http://a.example.com", "a")
+	app.Register("http://b.example.com:8080", "b")
+	conn := grpcSubject(t, app)
+	ctx := context.Background()
+
+	list := new(structpb.Struct)
+	if err := conn.Invoke(ctx, "/reverser.Proxies/ListProxies", &emptypb.Empty{}, list); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	proxies := app.ProxyList()
+	if len(list.Fields) != len(proxies) {
+		t.Errorf("Expected %d proxies, got %d", len(proxies), len(list.Fields))
+	}
+	for path, proxy := range proxies {
+		target := list.Fields[path].GetStructValue().GetFields()["target"].GetStringValue()
+		if target != NewProxyView(proxy).Target {
+			t.Errorf("Expected %s to target %s, got %q", path, NewProxyView(proxy).Target, target)
+		}
+	}
+
+	got := new(structpb.Struct)
+	if err := conn.Invoke(ctx, "/reverser.Proxies/GetProxy", wrapperspb.String("b"), got); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if path := got.Fields["path"].GetStringValue(); path != "b" {
+		t.Errorf("Expected b, got %q", path)
+	}
+	err := conn.Invoke(ctx, "/reverser.Proxies/GetProxy", wrapperspb.String("missing"), got)
+	if grpcstatus.Code(err) != codes.NotFound {
+		t.Errorf("Expected %s, got %v", codes.NotFound, err)
+	}
+}
+
+func TestGRPCRequiresAuth(t *testing.T) {
+	app := Subject()
+	app.Authenticator = BasicAuth{Username: "admin", Password: "secret"}
+	conn := grpcSubject(t, app)
+
+	list := new(structpb.Struct)
+	err := conn.Invoke(context.Background(), "/reverser.Proxies/ListProxies", &emptypb.Empty{}, list)
+	if grpcstatus.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected %s, got %v", codes.Unauthenticated, err)
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte("admin:secret"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+credentials)
+	if err := conn.Invoke(ctx, "/reverser.Proxies/ListProxies", &emptypb.Empty{}, list); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
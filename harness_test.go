@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Harness runs reverser in front of fake backends for integration tests.
+type Harness struct {
+	App      *App
+	Server   *httptest.Server
+	Client   *http.Client
+	t        *testing.T
+	backends map[string]*httptest.Server
+}
+
+// NewTestHarness starts a backend for each route, registers it under the
+// route's path and starts reverser in front of them. Everything is shut down
+// when the test ends.
+func NewTestHarness(t *testing.T, routes map[string]http.Handler) *Harness {
+	h := &Harness{App: Subject(), t: t, backends: make(map[string]*httptest.Server)}
+	for path, handler := range routes {
+		backend := httptest.NewServer(handler)
+		h.backends[path] = backend
+		if err := h.App.Register(backend.URL, path); err != nil {
+			h.Close()
+			t.Fatalf("Unexpected error registering %s: %s", path, err)
+		}
+	}
+	h.Server = httptest.NewServer(h.App.Router)
+	h.Client = h.Server.Client()
+	t.Cleanup(h.Close)
+	return h
+}
+
+// URL returns the address of path on reverser.
+func (h *Harness) URL(path string) string {
+	return h.Server.URL + path
+}
+
+// Backend returns the fake backend registered under path.
+func (h *Harness) Backend(path string) *httptest.Server {
+	return h.backends[path]
+}
+
+// Do sends a request to reverser and returns the response with its body read.
+func (h *Harness) Do(method string, path string, body io.Reader) (*http.Response, string) {
+	req, err := http.NewRequest(method, h.URL(path), body)
+	if err != nil {
+		h.t.Fatalf("Unexpected error %s", err)
+	}
+	res, err := h.Client.Do(req)
+	if err != nil {
+		h.t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		h.t.Fatalf("Unexpected error %s", err)
+	}
+	return res, string(content)
+}
+
+func (h *Harness) Get(path string) (*http.Response, string) {
+	return h.Do("GET", path, nil)
+}
+
+func (h *Harness) Close() {
+	if h.Server != nil {
+		h.Server.Close()
+	}
+	for _, backend := range h.backends {
+		backend.Close()
+	}
+}
+
+func TestHarness(t *testing.T) {
+	h := NewTestHarness(t, map[string]http.Handler{
+		"one": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("one")) }),
+		"two": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("two")) }),
+	})
+
+	for _, path := range []string{"one", "two"} {
+		proxy, err := h.App.Find(path)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if proxy.URL.String() != h.Backend(path).URL {
+			t.Errorf("Expected %s to target %s, got %s", path, h.Backend(path).URL, proxy.URL)
+		}
+		if _, body := h.Get("/proxy/" + path + "/"); body != path {
+			t.Errorf("Expected %s, got %s", path, body)
+		}
+	}
+	if res, _ := h.Do("POST", "/register", strings.NewReader("")); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the admin UI to be served, got %d", res.StatusCode)
+	}
+
+	h.Close()
+	if _, err := http.Get(h.URL("/")); err == nil {
+		t.Error("Expected the harness to be shut down after Close")
+	}
+}
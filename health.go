@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const DefaultHealthTimeout = 5 * time.Second
+
+// HealthStatus is the result of the last health check of a target. Since is
+// when the target last changed between healthy and unhealthy; it is zero
+// while the target is still in the state it was first seen in.
+type HealthStatus struct {
+	Healthy bool
+	Checked time.Time
+	Since   time.Time
+	Error   string
+}
+
+// Health holds the last known status of every checked target, keyed by the
+// target URL. It is safe for concurrent use.
+type Health struct {
+	sync.RWMutex
+	status map[string]HealthStatus
+}
+
+func NewHealth() *Health {
+	return &Health{status: make(map[string]HealthStatus)}
+}
+
+func (h *Health) Set(target *url.URL, status HealthStatus) {
+	h.Lock()
+	defer h.Unlock()
+	if previous, ok := h.status[target.String()]; ok {
+		if previous.Healthy == status.Healthy {
+			status.Since = previous.Since
+		} else {
+			status.Since = status.Checked
+		}
+	}
+	h.status[target.String()] = status
+}
+
+// Status returns the last status of target, and false if it was never checked.
+func (h *Health) Status(target *url.URL) (HealthStatus, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	status, ok := h.status[target.String()]
+	return status, ok
+}
+
+// Healthy reports whether target passed its last check. Targets that haven't
+// been checked yet are assumed healthy.
+func (h *Health) Healthy(target *url.URL) bool {
+	status, ok := h.Status(target)
+	return !ok || status.Healthy
+}
+
+// FailoverBalancer sends everything to the first backend while it is
+// healthy, and to the first healthy backup otherwise.
+type FailoverBalancer struct {
+	Health *Health
+}
+
+func (b FailoverBalancer) Pick(req *http.Request, backends []*url.URL) *url.URL {
+	for _, backend := range backends {
+		if b.Health.Healthy(backend) {
+			return backend
+		}
+	}
+	return backends[0]
+}
+
+// checkTarget probes one target of proxy at its HealthPath. Any 2xx or 3xx
+// response counts as healthy. Probes share the proxy's request timeout.
+func (app *App) checkTarget(proxy *Proxy, target *url.URL) HealthStatus {
+	timeout := app.timeoutFor(proxy)
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	client := &http.Client{
+		Transport: app.transportFor(proxy),
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	checkURL := *target
+	if proxy.HealthPath != "" {
+		checkURL.Path = proxy.HealthPath
+	}
+	status := HealthStatus{Checked: time.Now()}
+	res, err := client.Get(checkURL.String())
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	res.Body.Close()
+	status.Healthy = res.StatusCode >= 200 && res.StatusCode < 400
+	if !status.Healthy {
+		status.Error = res.Status
+	}
+	return status
+}
+
+// CheckHealth probes every backend of every registered proxy once and
+// records the results.
+func (app *App) CheckHealth() {
+	var wg sync.WaitGroup
+	for _, proxy := range app.ProxyList() {
+		if proxy.Static() {
+			continue
+		}
+		for _, target := range proxy.Backends {
+			wg.Add(1)
+			go func(proxy *Proxy, target *url.URL) {
+				defer wg.Done()
+				app.Health.Set(target, app.checkTarget(proxy, target))
+			}(proxy, target)
+		}
+	}
+	wg.Wait()
+}
+
+// StartHealthChecks runs CheckHealth every interval until stop is closed.
+func (app *App) StartHealthChecks(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			app.CheckHealth()
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// ProxyHealth summarises the health of a proxy's backends for display. A
+// proxy is healthy while any of its backends passed its last check.
+type ProxyHealth struct {
+	Checked     bool
+	Healthy     bool
+	LastChecked time.Time
+	Error       string
+}
+
+// HealthSnapshot returns the health of every registered proxy, keyed by
+// path. Proxies whose backends haven't been checked yet are left unchecked.
+func (app *App) HealthSnapshot() map[string]ProxyHealth {
+	snapshot := make(map[string]ProxyHealth)
+	for path, proxy := range app.ProxyList() {
+		var health ProxyHealth
+		for _, backend := range proxy.Backends {
+			status, ok := app.Health.Status(backend)
+			if !ok {
+				continue
+			}
+			health.Checked = true
+			health.Healthy = health.Healthy || status.Healthy
+			if status.Checked.After(health.LastChecked) {
+				health.LastChecked = status.Checked
+			}
+			if !status.Healthy && health.Error == "" {
+				health.Error = status.Error
+			}
+		}
+		if health.Healthy {
+			health.Error = ""
+		}
+		snapshot[path] = health
+	}
+	return snapshot
+}
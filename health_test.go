@@ -0,0 +1,189 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailoverBalancer(t *testing.T) {
+	var primaryDown int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && atomic.LoadInt32(&primaryDown) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backup"))
+	}))
+	defer backup.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(primary.URL+","+backup.URL, "app", ProxyOptions{
+		ProxyDefaults: ProxyDefaults{HealthPath: "/health"},
+		Balancer:      FailoverBalancer{Health: app.Health},
+	})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	app.CheckHealth()
+	if content := get(t, server.URL+"/proxy/app/"); content != "primary" {
+		t.Errorf("Expected the healthy primary to serve, got %s", content)
+	}
+
+	atomic.StoreInt32(&primaryDown, 1)
+	app.CheckHealth()
+	if content := get(t, server.URL+"/proxy/app/"); content != "backup" {
+		t.Errorf("Expected failover to the backup, got %s", content)
+	}
+
+	atomic.StoreInt32(&primaryDown, 0)
+	app.CheckHealth()
+	if content := get(t, server.URL+"/proxy/app/"); content != "primary" {
+		t.Errorf("Expected traffic back on the recovered primary, got %s", content)
+	}
+}
+
+func TestFailoverBalancerFromConfig(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backup"))
+	}))
+	defer backup.Close()
+
+	config, errs, err := LoadConfig(writeConfig(t, `{"proxies": [
+		{"path": "app", "target": "`+primary.URL+","+backup.URL+`", "options": {"balancer": {"type": "failover"}}},
+		{"path": "bad", "target": "http://bad.example.com", "options": {"balancer": {"type": "random"}}}
+	]}`))
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("Unexpected error %v %v", err, errs)
+	}
+	app := Subject()
+	if loaded := app.LoadProxies(config); loaded != 1 {
+		t.Errorf("Expected the unknown balancer to be skipped, loaded %d", loaded)
+	}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	app.CheckHealth()
+	for i := 0; i < 3; i++ {
+		if content := get(t, server.URL+"/proxy/app/"); content != "backup" {
+			t.Errorf("Expected failover to the backup, got %s", content)
+		}
+	}
+}
+
+func TestHealthShownInUI(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	app := Subject()
+	app.Register(up.URL, "up")
+	app.Register(down.URL, "down")
+	app.CheckHealth()
+	app.Register("http://unchecked.invalid", "unchecked")
+
+	snapshot := app.HealthSnapshot()
+	if !snapshot["up"].Checked || !snapshot["up"].Healthy {
+		t.Errorf("Expected up to be healthy, got %+v", snapshot["up"])
+	}
+	if !snapshot["down"].Checked || snapshot["down"].Healthy || snapshot["down"].Error == "" {
+		t.Errorf("Expected down to be unhealthy with an error, got %+v", snapshot["down"])
+	}
+	if snapshot["unchecked"].Checked {
+		t.Errorf("Expected unchecked to have no status yet, got %+v", snapshot["unchecked"])
+	}
+
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	content := get(t, server.URL+"/")
+	for _, badge := range []string{`badge-success`, `badge-danger`, `badge-secondary`} {
+		if !strings.Contains(content, badge) {
+			t.Errorf("Expected a %s indicator on the index, got %s", badge, content)
+		}
+	}
+}
+
+// TestConcurrentHealthAndMetrics is meant for go test -race: health checks,
+// proxied traffic and updates run while the UI, API and metrics read the
+// same proxies.
+func TestConcurrentHealthAndMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "busy", ProxyOptions{ProxyDefaults: ProxyDefaults{HealthPath: "/health"}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				f()
+			}
+		}()
+	}
+	fetch := func(path string) func() {
+		return func() {
+			res, err := http.Get(server.URL + path)
+			if err != nil {
+				t.Errorf("Unexpected error %s", err)
+				return
+			}
+			ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+	}
+	run(fetch("/proxy/busy/"))
+	run(fetch("/proxy/busy/"))
+	run(fetch("/"))
+	run(fetch("/metrics"))
+	run(fetch("/api/proxies"))
+	run(app.CheckHealth)
+	run(func() { app.HealthSnapshot() })
+	run(func() { app.Update(backend.URL, "busy") })
+	wg.Wait()
+}
+
+func TestHealthCheckUsesRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	app := Subject()
+	app.RequestTimeout = 50 * time.Millisecond
+	app.Register(backend.URL, "slow")
+	proxy, _ := app.Find("slow")
+
+	start := time.Now()
+	status := app.checkTarget(proxy, proxy.URL)
+	if status.Error == "" {
+		t.Error("Expected a slow target to fail its health check")
+	}
+	if elapsed := time.Since(start); elapsed >= DefaultHealthTimeout {
+		t.Errorf("Expected the check to stop at the request timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHistogramBuckets are the upper bounds, in seconds, of the latency
+// histogram buckets. They match the Prometheus client defaults.
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts durations into DefaultHistogramBuckets. The zero value is
+// ready to use.
+type Histogram struct {
+	sync.Mutex
+	counts []int64
+	count  int64
+	sum    time.Duration
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	if h.counts == nil {
+		h.counts = make([]int64, len(DefaultHistogramBuckets))
+	}
+	i := sort.SearchFloat64s(DefaultHistogramBuckets, d.Seconds())
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += d
+}
+
+// Cumulative returns, for each of DefaultHistogramBuckets, how many
+// observations were at most its bound, followed by the total count and sum.
+func (h *Histogram) Cumulative() ([]int64, int64, time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	cumulative := make([]int64, len(DefaultHistogramBuckets))
+	var running int64
+	for i := range cumulative {
+		if h.counts != nil {
+			running += h.counts[i]
+		}
+		cumulative[i] = running
+	}
+	return cumulative, h.count, h.sum
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const DefaultHMACHeader = "X-Signature"
+
+// requestSignature is the hex encoded HMAC-SHA256 of the method, path and
+// body, separated by newlines.
+func requestSignature(secret string, method string, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signRequest buffers the request body and attaches its signature for
+// upstreams that authenticate requests by HMAC. A body that can't be read is
+// sent unsigned and fails upstream with the read error.
+func (p *Proxy) signRequest(req *http.Request) {
+	if p.HMACSecret == "" {
+		return
+	}
+	header := p.HMACHeader
+	if header == "" {
+		header = DefaultHMACHeader
+	}
+	req.Header.Del(header)
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			req.Body = ioutil.NopCloser(errorReader{err})
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	req.Header.Set(header, requestSignature(p.HMACSecret, req.Method, req.URL.Path, body))
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
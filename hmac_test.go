@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHMACSignature(t *testing.T) {
+	verified := make(chan bool, 2)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(r.Method + "\n" + r.URL.Path + "\n" + string(body)))
+		signature, _ := hex.DecodeString(r.Header.Get("X-Hub-Signature"))
+		verified <- hmac.Equal(signature, mac.Sum(nil)) && string(body) == "payload"
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "signed", ProxyOptions{HMACSecret: "s3cret", HMACHeader: "X-Hub-Signature"})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/proxy/signed/hooks", strings.NewReader("payload"))
+	req.Header.Set("X-Hub-Signature", "forged")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if !<-verified {
+		t.Error("Expected the backend to verify the signature and receive the body")
+	}
+}
+
+func TestRequestSignatureCoversBody(t *testing.T) {
+	a := requestSignature("key", "POST", "/hooks", []byte("one"))
+	b := requestSignature("key", "POST", "/hooks", []byte("two"))
+	if a == b {
+		t.Error("Expected different bodies to sign differently")
+	}
+	if a != requestSignature("key", "POST", "/hooks", []byte("one")) {
+		t.Error("Expected signatures to be deterministic")
+	}
+}
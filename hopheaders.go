@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultHopHeaders are the hop-by-hop headers httputil.ReverseProxy always
+// removes before forwarding, along with any header named in Connection. They
+// describe the client's connection to reverser, not reverser's to the
+// upstream.
+var DefaultHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// stripHopHeaders removes the proxy's StripHopHeaders on top of the defaults.
+func (p *Proxy) stripHopHeaders(req *http.Request) {
+	for _, name := range p.StripHopHeaders {
+		req.Header.Del(name)
+	}
+}
+
+type preservedHeadersKey struct{}
+
+// preserveHeaders remembers the client's values of names before
+// ReverseProxy strips them, for preserveHeadersTransport to put back.
+func preserveHeaders(next http.Handler, names []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		preserved := make(http.Header)
+		for _, name := range names {
+			if values := r.Header.Values(name); len(values) > 0 {
+				preserved[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+		ctx := context.WithValue(r.Context(), preservedHeadersKey{}, preserved)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type preserveHeadersTransport struct {
+	next http.RoundTripper
+}
+
+func (t *preserveHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	preserved, _ := req.Context().Value(preservedHeadersKey{}).(http.Header)
+	if len(preserved) > 0 {
+		req = req.Clone(req.Context())
+		for name, values := range preserved {
+			req.Header[name] = values
+		}
+	}
+	return t.next.RoundTrip(req)
+}
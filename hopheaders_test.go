@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHopHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "hops", ProxyOptions{
+		StripHopHeaders: []string{"X-Conn-Id"},
+		PreserveHeaders: []string{"Proxy-Authorization"},
+	})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/hops/", nil)
+	req.Header.Set("X-Conn-Id", "42")
+	req.Header.Set("Proxy-Authorization", "Basic dXNlcjpwYXNz")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+
+	if value := got.Get("X-Conn-Id"); value != "" {
+		t.Errorf("Expected X-Conn-Id to be stripped, got %q", value)
+	}
+	if value := got.Get("Proxy-Authorization"); value != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Expected Proxy-Authorization to be preserved, got %q", value)
+	}
+	if value := got.Get("Keep-Alive"); value != "" {
+		t.Errorf("Expected Keep-Alive to still be stripped, got %q", value)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// hostAllowed reports whether the inbound Host may be forwarded. Entries in
+// AllowedHosts match with or without a port; an empty list allows any host.
+func (p *Proxy) hostAllowed(host string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+	return matchHost(p.AllowedHosts, host)
+}
+
+// matchHost reports whether host is in hosts, compared case insensitively
+// and with or without its port.
+func matchHost(hosts []string, host string) bool {
+	host = strings.ToLower(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if allowed == host || allowed == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// adminHost reports whether host reaches reverser's own admin UI and API:
+// it is AdminHost, or a name for the listen address.
+func (app *App) adminHost(host string) bool {
+	if app.AdminHost != "" && matchHost([]string{app.AdminHost}, host) {
+		return true
+	}
+	if app.ListenAddr == "" {
+		return false
+	}
+	hostname := strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = h
+	}
+	listenHost, _, err := net.SplitHostPort(app.ListenAddr)
+	if err != nil {
+		return false
+	}
+	if listenHost == "" || net.ParseIP(listenHost) != nil && net.ParseIP(listenHost).IsUnspecified() {
+		return hostname != "" && isLocalHost(hostname)
+	}
+	return hostname == strings.ToLower(listenHost) || isLocalHost(hostname) && isLocalHost(listenHost)
+}
+
+// checkHosts rejects Hosts that would route the admin host to a proxy,
+// locking the operator out of the admin UI and API.
+func (app *App) checkHosts(hosts []string) error {
+	for _, host := range hosts {
+		if app.adminHost(host) {
+			return fmt.Errorf("host %s is reverser's own admin host", host)
+		}
+	}
+	return nil
+}
+
+// indexHosts adds proxy's Hosts to the store's host index, or removes them.
+// The lock must be held.
+func (s *Store) indexHosts(proxy *Proxy, add bool) {
+	for _, host := range proxy.Hosts {
+		host = strings.ToLower(host)
+		paths := s.hosts[host]
+		if add {
+			if paths == nil {
+				paths = make(map[string]bool)
+				s.hosts[host] = paths
+			}
+			paths[proxy.Path] = true
+			continue
+		}
+		delete(paths, proxy.Path)
+		if len(paths) == 0 {
+			delete(s.hosts, host)
+		}
+	}
+}
+
+// FindHost returns the path of the proxy whose Hosts include host, matched
+// like matchHost. When several claim it the first path in sort order wins.
+func (s *Store) FindHost(host string) (string, bool) {
+	host = strings.ToLower(host)
+	keys := []string{host}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		keys = append(keys, hostname)
+	}
+	s.Lock()
+	defer s.Unlock()
+	var paths []string
+	for _, key := range keys {
+		for path := range s.hosts[key] {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return "", false
+	}
+	sort.Strings(paths)
+	return paths[0], true
+}
+
+// resolveHost finds the proxy a request is addressed to by its Host header.
+// Nothing is stripped from the path.
+func (app *App) resolveHost(r *http.Request) (*Proxy, string, error) {
+	path, ok := app.FindHost(r.Host)
+	if !ok {
+		return nil, "", fmt.Errorf("no proxy for host %s: %w", r.Host, ErrNotFound)
+	}
+	proxy, err := app.Find(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return proxy, "", nil
+}
+
+// MountHostHandler forwards requests for the Hosts of any proxy ahead of
+// every other route, so it must be mounted first. The admin host is never
+// routed away, even for proxies loaded from a store file.
+func (app *App) MountHostHandler() {
+	app.Router.MatcherFunc(func(r *http.Request, rm *mux.RouteMatch) bool {
+		if app.adminHost(r.Host) {
+			return false
+		}
+		_, ok := app.FindHost(r.Host)
+		return ok
+	}).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.serveProxy(w, r, app.resolveHost)
+	})
+}
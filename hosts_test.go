@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAllowedHosts(t *testing.T) {
+	var host string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "vhost", ProxyOptions{PreserveHost: true, AllowedHosts: []string{"app.example.com"}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/vhost/", nil)
+	req.Host = "app.example.com:8000"
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d for an allowed host, got %d", http.StatusOK, res.StatusCode)
+	}
+	if host != "app.example.com:8000" {
+		t.Errorf("Expected the inbound Host to be preserved, got %s", host)
+	}
+
+	host = ""
+	req.Host = "evil.example.com"
+	if res := status(t, req); res.StatusCode != http.StatusMisdirectedRequest {
+		t.Errorf("Expected status %d for a foreign host, got %d", http.StatusMisdirectedRequest, res.StatusCode)
+	}
+	if host != "" {
+		t.Error("Expected a misdirected request not to be forwarded")
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.URL.Path, r.URL.RawQuery)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "app", ProxyOptions{Hosts: []string{"app.local"}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	for _, path := range []string{"/", "/assets/app.js?v=2", "/proxy/other/x"} {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Host = "App.Local:8000"
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		content, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		expected := strings.Replace(path, "?", " ", 1)
+		if !strings.Contains(path, "?") {
+			expected += " "
+		}
+		if string(content) != expected {
+			t.Errorf("Expected %s to reach the backend as %q, got %d %q", path, expected, res.StatusCode, content)
+		}
+	}
+
+	if body := get(t, server.URL+"/proxy/app/by-path"); body != "/by-path " {
+		t.Errorf("Expected path routing to keep working, got %q", body)
+	}
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	req.Host = "admin.local"
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(content) == "/ " || res.StatusCode != http.StatusOK {
+		t.Errorf("Expected other hosts to get the admin UI, got %d %s", res.StatusCode, content)
+	}
+}
+
+func TestStoreHostIndex(t *testing.T) {
+	store := NewStore()
+	store.MaxProxies = 3
+	store.Eviction = EvictLRU
+	found := func(host string) string {
+		path, _ := store.FindHost(host)
+		return path
+	}
+
+	store.RegisterWithOptions("http://b.example.com", "b", ProxyOptions{Hosts: []string{"Shared.local"}})
+	store.RegisterWithOptions("http://a.example.com", "a", ProxyOptions{Hosts: []string{"shared.local", "a.local:8080"}})
+	if path := found("shared.local:8000"); path != "a" {
+		t.Errorf("Expected the first path in sort order to win, got %q", path)
+	}
+	if path := found("A.local:8080"); path != "a" {
+		t.Errorf("Expected a host with a port to match, got %q", path)
+	}
+	if path := found("a.local:9090"); path != "" {
+		t.Errorf("Expected another port not to match, got %q", path)
+	}
+
+	store.UpdateWithOptions("http://a.example.com", "a", ProxyOptions{Hosts: []string{"new.local"}})
+	if found("shared.local") != "b" || found("a.local:8080") != "" || found("new.local") != "a" {
+		t.Errorf("Expected an update to replace the proxy's hosts")
+	}
+	store.Rename("a", "renamed")
+	if path := found("new.local"); path != "renamed" {
+		t.Errorf("Expected a rename to move the proxy's hosts, got %q", path)
+	}
+	store.Unregister("b")
+	if path := found("shared.local"); path != "" {
+		t.Errorf("Expected an unregistered proxy's hosts to be dropped, got %q", path)
+	}
+
+	store.Find("renamed")
+	store.Register("http://c.example.com", "c")
+	store.Register("http://d.example.com", "d")
+	store.Register("http://e.example.com", "e")
+	if path := found("new.local"); path != "" {
+		t.Errorf("Expected an evicted proxy's hosts to be dropped, got %q", path)
+	}
+	if len(store.hosts) != 0 {
+		t.Errorf("Expected an empty index, got %v", store.hosts)
+	}
+}
+
+func TestAdminHostNotShadowed(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "backend")
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.ListenAddr = ":8000"
+	app.AdminHost = "admin.example.com"
+	for _, host := range []string{"localhost", "127.0.0.1:8000", "Admin.Example.com"} {
+		if err := app.RegisterWithOptions(backend.URL, "app", ProxyOptions{Hosts: []string{host}}); err == nil {
+			t.Errorf("Expected an error registering the admin host %s", host)
+		}
+	}
+	app.RegisterWithOptions(backend.URL, "app", ProxyOptions{Hosts: []string{"app.local"}})
+	if err := app.UpdateWithOptions(backend.URL, "app", ProxyOptions{Hosts: []string{"admin.example.com"}}); err == nil {
+		t.Error("Expected an error updating a proxy to the admin host")
+	}
+
+	// A proxy already claiming the admin host, e.g. from a store file.
+	app.DataStore.UpdateWithOptions(backend.URL, "app", ProxyOptions{Hosts: []string{"admin.example.com"}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	for _, path := range []string{"/", "/healthz"} {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Host = "admin.example.com"
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		content, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(content) == "backend" {
+			t.Errorf("Expected %s on the admin host to stay with reverser", path)
+		}
+	}
+}
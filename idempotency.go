@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+var errIdempotencyInFlight = errors.New("a request with this Idempotency-Key is already in progress")
+
+// idempotencyTransport sends a request carrying an Idempotency-Key upstream
+// once and replays its response to repeats of it for ttl, marked with
+// Idempotent-Replayed. A repeat arriving while the first is still in flight
+// fails with a 409 rather than waiting, since the client can't tell whether
+// the write happened. 5xx responses aren't kept, so those can be retried.
+type idempotencyTransport struct {
+	next  http.RoundTripper
+	cache *ResponseCache
+	ttl   time.Duration
+}
+
+func (t *idempotencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotencyKey := req.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" || isUpgrade(req) {
+		return t.next.RoundTrip(req)
+	}
+	key := req.Method + " " + req.URL.RequestURI() + " " + idempotencyKey
+	c := t.cache
+	c.Lock()
+	if entry, ok := c.entries[key]; ok && c.now().Sub(entry.stored) < t.ttl {
+		c.Unlock()
+		res := entry.replay(req)
+		res.Header.Set("Idempotent-Replayed", "true")
+		return res, nil
+	}
+	if _, ok := c.calls[key]; ok {
+		c.Unlock()
+		return nil, errIdempotencyInFlight
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.Unlock()
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		c.finish(key, call, t.ttl, false)
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, DefaultCacheBodyLimit+1))
+	if err != nil {
+		res.Body.Close()
+		c.finish(key, call, t.ttl, false)
+		return nil, err
+	}
+	if len(body) > DefaultCacheBodyLimit {
+		res.Body = readCloser{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		c.finish(key, call, t.ttl, false)
+		return res, nil
+	}
+	res.Body.Close()
+	call.entry = &cachedResponse{status: res.StatusCode, header: res.Header, body: body, stored: c.now()}
+	c.finish(key, call, t.ttl, res.StatusCode < 500)
+	return call.entry.replay(req), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&hits, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s #%d", body, n)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "pay", ProxyOptions{IdempotencyTTL: time.Minute})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	send := func(key string) (*http.Response, string) {
+		req, _ := http.NewRequest("POST", server.URL+"/proxy/pay/charges", strings.NewReader("charge"))
+		req.Header.Set("Idempotency-Key", key)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return res, string(body)
+	}
+
+	first, firstBody := send("abc")
+	second, secondBody := send("abc")
+	if n := atomic.LoadInt64(&hits); n != 1 {
+		t.Errorf("Expected the backend to be hit once, got %d", n)
+	}
+	if second.StatusCode != first.StatusCode || secondBody != firstBody {
+		t.Errorf("Expected the same response twice, got %d %q and %d %q", first.StatusCode, firstBody, second.StatusCode, secondBody)
+	}
+	if second.Header.Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected the repeat to be marked as replayed")
+	}
+
+	if _, body := send("def"); body != "charge #2" {
+		t.Errorf("Expected a new key to reach the backend, got %q", body)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// ImportConfig is the complete set of proxies to import. Registered proxies
+// missing from it are removed.
+type ImportConfig struct {
+	Proxies []ImportProxy `json:"proxies"`
+}
+
+type ImportProxy struct {
+	Path    string       `json:"path"`
+	Target  string       `json:"target"`
+	Options ProxyOptions `json:"options"`
+}
+
+// ImportDiff lists the paths an import adds, removes and changes.
+type ImportDiff struct {
+	DryRun  bool     `json:"dry_run"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// stagingStore returns an empty store with the app's groups, for
+// validating proxies without touching the app's own store.
+func (app *App) stagingStore() *Store {
+	staged := NewStore()
+	for name, defaults := range app.Groups() {
+		staged.RegisterGroup(name, defaults)
+	}
+	return staged
+}
+
+// stageEntry validates entry by registering it into staged, running the same
+// checks as App.RegisterWithOptions.
+func (app *App) stageEntry(staged *Store, entry ImportProxy) error {
+	if entry.Path == "" {
+		return fmt.Errorf("proxy with target %s has no path", entry.Target)
+	}
+	if _, err := staged.Find(NormalizePath(entry.Path)); err == nil {
+		return fmt.Errorf("path %s is listed twice", entry.Path)
+	}
+	target, err := app.prepareTarget(entry.Target)
+	if err != nil {
+		return fmt.Errorf("%s: %s", entry.Path, err)
+	}
+	if err := app.checkPathLength(entry.Path); err != nil {
+		return fmt.Errorf("%s: %s", entry.Path, err)
+	}
+	if err := app.checkSelfTarget(target); err != nil {
+		return fmt.Errorf("%s: %s", entry.Path, err)
+	}
+	if err := app.checkHosts(entry.Options.Hosts); err != nil {
+		return fmt.Errorf("%s: %s", entry.Path, err)
+	}
+	if err := staged.RegisterWithOptions(target, entry.Path, entry.Options); err != nil {
+		return fmt.Errorf("%s: %s", entry.Path, err)
+	}
+	return nil
+}
+
+// stage validates config by registering it into a staging store, stopping at
+// the first invalid proxy.
+func (app *App) stage(config ImportConfig) (*Store, error) {
+	staged := app.stagingStore()
+	for _, entry := range config.Proxies {
+		if err := app.stageEntry(staged, entry); err != nil {
+			return nil, err
+		}
+	}
+	return staged, nil
+}
+
+// ValidateConfig checks every proxy in config, returning an error for each
+// invalid one.
+func (app *App) ValidateConfig(config ImportConfig) []error {
+	staged := app.stagingStore()
+	var errs []error
+	for _, entry := range config.Proxies {
+		if err := app.stageEntry(staged, entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// LoadConfig reads an import config from a JSON file. Each entry is decoded
+// on its own, so a malformed entry or an unknown field only costs that entry:
+// it is left out of the config and reported in the returned slice, along
+// with its position. The error is for files that can't be read or parsed.
+func LoadConfig(path string) (ImportConfig, []error, error) {
+	var config ImportConfig
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, nil, err
+	}
+	var raw struct {
+		Proxies []json.RawMessage `json:"proxies"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return config, nil, fmt.Errorf("%s: %s", path, err)
+	}
+	var errs []error
+	for i, message := range raw.Proxies {
+		var entry ImportProxy
+		decoder := json.NewDecoder(bytes.NewReader(message))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entry); err != nil {
+			errs = append(errs, fmt.Errorf("%s: entry %d: %s", path, i+1, err))
+			continue
+		}
+		config.Proxies = append(config.Proxies, entry)
+	}
+	return config, errs, nil
+}
+
+// loadConfigFile registers the proxies in the config file at path, logging
+// the entries it skips.
+func (app *App) loadConfigFile(path string) error {
+	config, errs, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		app.Logger.Printf("config: skipping %s", err)
+	}
+	loaded := app.LoadProxies(config)
+	app.Logger.Printf("loaded %d of %d proxies from %s", loaded, len(config.Proxies)+len(errs), path)
+	return nil
+}
+
+// LoadProxies registers every proxy in config, replacing any already
+// registered at the same path. Invalid entries are logged and skipped; it
+// returns how many were loaded.
+func (app *App) LoadProxies(config ImportConfig) int {
+	loaded := 0
+	for _, entry := range config.Proxies {
+		var err error
+		if entry.Path == "" {
+			err = fmt.Errorf("proxy with target %s has no path", entry.Target)
+		} else if _, findErr := app.Find(NormalizePath(entry.Path)); findErr == nil {
+			err = app.UpdateWithOptions(entry.Target, NormalizePath(entry.Path), entry.Options)
+		} else {
+			err = app.RegisterWithOptions(entry.Target, entry.Path, entry.Options)
+		}
+		if err != nil {
+			app.Logger.Printf("config: skipping %s: %s", entry.Path, err)
+			continue
+		}
+		loaded++
+	}
+	return loaded
+}
+
+// sameProxy reports whether two proxies forward to the same targets with the
+// same options.
+func sameProxy(a *Proxy, b *Proxy) bool {
+	if !reflect.DeepEqual(a.Backends, b.Backends) || !reflect.DeepEqual(a.Canary, b.Canary) {
+		return false
+	}
+	return reflect.DeepEqual(a.ProxyOptions, b.ProxyOptions)
+}
+
+// diff compares the staged proxies against the registered ones.
+func diff(current map[string]*Proxy, staged map[string]*Proxy) ImportDiff {
+	result := ImportDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for path, proxy := range staged {
+		existing, ok := current[path]
+		if !ok {
+			result.Added = append(result.Added, path)
+		} else if !sameProxy(existing, proxy) {
+			result.Changed = append(result.Changed, path)
+		}
+	}
+	for path := range current {
+		if _, ok := staged[path]; !ok {
+			result.Removed = append(result.Removed, path)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+	return result
+}
+
+// Import replaces the registered proxies with config and returns what
+// changed. The whole config is validated before anything is touched, then
+// swapped in at once, so a failed import leaves the registered proxies as
+// they were. With dryRun the store is left as it was.
+func (app *App) Import(config ImportConfig, dryRun bool) (ImportDiff, error) {
+	staged, err := app.stage(config)
+	if err != nil {
+		return ImportDiff{}, err
+	}
+	result := diff(app.ProxyList(), staged.ProxyList())
+	result.DryRun = dryRun
+	if dryRun {
+		return result, nil
+	}
+	if err := app.ReplaceAll(staged.store); err != nil {
+		return ImportDiff{}, err
+	}
+	return result, nil
+}
+
+func (app *App) MountImportHandler() {
+	app.HandleAPI("/api/import", func(w http.ResponseWriter, r *http.Request) {
+		var config ImportConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		dryRun := r.URL.Query().Get("dry_run")
+		before := app.ProxyList()
+		result, err := app.Import(config, dryRun != "" && dryRun != "0" && dryRun != "false")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !result.DryRun {
+			app.auditImport(r, before, result)
+		}
+		writeJSON(w, http.StatusOK, result)
+	}).Methods("POST")
+}
+
+// auditImport records each change an import made, given the proxies
+// registered before it.
+func (app *App) auditImport(r *http.Request, before map[string]*Proxy, result ImportDiff) {
+	after := app.ProxyList()
+	for _, path := range result.Removed {
+		app.Audit(r, "unregister", path, before[path].Target(), "")
+	}
+	for _, path := range result.Added {
+		if proxy, ok := after[path]; ok {
+			app.Audit(r, "register", path, "", proxy.Target())
+		}
+	}
+	for _, path := range result.Changed {
+		if proxy, ok := after[path]; ok {
+			app.Audit(r, "update", path, before[path].Target(), proxy.Target())
+		}
+	}
+}
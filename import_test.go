@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func importConfig(t *testing.T, url string, config string) (*http.Response, ImportDiff) {
+	res, err := http.Post(url, "application/json", strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	var result ImportDiff
+	json.NewDecoder(res.Body).Decode(&result)
+	return res, result
+}
+
+func TestImportDryRun(t *testing.T) {
+	app := Subject()
+	app.Register("http://kept.example.com", "kept")
+	app.Register("http://old.example.com", "moved")
+	app.RegisterWithOptions("http://slow.example.com", "tuned", ProxyOptions{ProxyDefaults: ProxyDefaults{Timeout: time.Second}})
+	app.Register("http://gone.example.com", "gone")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	config := `{"proxies": [
+		{"path": "kept", "target": "http://kept.example.com"},
+		{"path": "moved", "target": "http://new.example.com"},
+		{"path": "tuned", "target": "http://slow.example.com", "options": {"Timeout": 2000000000}},
+		{"path": "fresh", "target": "http://fresh.example.com"}
+	]}`
+	res, result := importConfig(t, server.URL+"/api/import?dry_run=1", config)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", res.StatusCode)
+	}
+	expected := ImportDiff{DryRun: true, Added: []string{"fresh"}, Removed: []string{"gone"}, Changed: []string{"moved", "tuned"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+	if _, err := app.Find("gone"); err != nil {
+		t.Error("Expected a dry run to leave the store untouched")
+	}
+	if _, err := app.Find("fresh"); err == nil {
+		t.Error("Expected a dry run not to register new proxies")
+	}
+
+	importConfig(t, server.URL+"/api/import", config)
+	if _, err := app.Find("gone"); err == nil {
+		t.Error("Expected the import to remove unlisted proxies")
+	}
+	if proxy, _ := app.Find("moved"); proxy.URL.Host != "new.example.com" {
+		t.Errorf("Expected the import to update moved, got %s", proxy.URL)
+	}
+	if _, result := importConfig(t, server.URL+"/api/import?dry_run=1", config); len(result.Added)+len(result.Removed)+len(result.Changed) != 0 {
+		t.Errorf("Expected no changes after importing, got %+v", result)
+	}
+}
+
+func TestImportRejectsInvalidConfig(t *testing.T) {
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, _ := importConfig(t, server.URL+"/api/import?dry_run=1", `{"proxies": [{"path": "a", "target": "http://a"}, {"path": "a", "target": "http://b"}]}`)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a duplicate path, got %d", res.StatusCode)
+	}
+}
+
+func TestImportUsesAppValidation(t *testing.T) {
+	app := Subject()
+	app.DefaultScheme = "https"
+	app.MaxPathLength = 8
+	app.Register("example.com", "plain")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, _ := importConfig(t, server.URL+"/api/import?dry_run=1", `{"proxies": [{"path": "much-too-long", "target": "http://a"}]}`)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a path over MaxPathLength, got %d", res.StatusCode)
+	}
+
+	res, result := importConfig(t, server.URL+"/api/import", `{"proxies": [{"path": "plain", "target": "example.com"}, {"path": "fresh", "target": "fresh.example.com"}]}`)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", res.StatusCode)
+	}
+	if len(result.Changed) != 0 {
+		t.Errorf("Expected the default scheme to be applied before diffing, got %+v", result)
+	}
+	if proxy, err := app.Find("fresh"); err != nil || proxy.Target() != "https://fresh.example.com" {
+		t.Errorf("Expected fresh to forward to https://fresh.example.com, got %v %v", proxy, err)
+	}
+}
+
+func TestImportRequiresJSON(t *testing.T) {
+	app := Subject()
+	app.Register("http://kept.example.com", "kept")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/api/import", "text/plain", strings.NewReader(`{"proxies": []}`))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status %d for a text/plain import, got %d", http.StatusUnsupportedMediaType, res.StatusCode)
+	}
+	if _, err := app.Find("kept"); err != nil {
+		t.Error("Expected a rejected import to leave the store untouched")
+	}
+}
+
+func TestImportIsAllOrNothing(t *testing.T) {
+	store := NewStore()
+	store.MaxProxies = 2
+	app := NewApp(template.Must(LoadTemplates("")), store)
+	app.Setup()
+	app.Register("http://a.example.com", "a")
+	app.Register("http://b.example.com", "b")
+
+	config := ImportConfig{Proxies: []ImportProxy{
+		{Path: "c", Target: "http://c.example.com"},
+		{Path: "d", Target: "http://d.example.com"},
+		{Path: "e", Target: "http://e.example.com"},
+	}}
+	if _, err := app.Import(config, false); err == nil {
+		t.Fatal("Expected an import past MaxProxies to fail")
+	}
+	for _, path := range []string{"a", "b"} {
+		if _, err := app.Find(path); err != nil {
+			t.Errorf("Expected %s to survive the failed import, got %s", path, err)
+		}
+	}
+	if len(app.ProxyList()) != 2 {
+		t.Errorf("Expected nothing from the failed import to be registered, got %d proxies", len(app.ProxyList()))
+	}
+}
+
+func TestLoadProxies(t *testing.T) {
+	app := Subject()
+	var logs bytes.Buffer
+	app.Logger = log.New(&logs, "", 0)
+	app.Register("http://localhost:9000", "existing")
+
+	config := ImportConfig{Proxies: []ImportProxy{
+		{Path: "api", Target: "http://localhost:9001"},
+		{Path: "/web", Target: "http://localhost:9002"},
+		{Path: "existing", Target: "http://localhost:9003"},
+		{Path: "bad", Target: "not a url"},
+		{Path: "a/b", Target: "http://localhost:9004"},
+		{Path: "", Target: "http://localhost:9005"},
+	}}
+	if loaded := app.LoadProxies(config); loaded != 3 {
+		t.Errorf("Expected 3 proxies loaded, got %d", loaded)
+	}
+	for path, target := range map[string]string{"api": "http://localhost:9001", "web": "http://localhost:9002", "existing": "http://localhost:9003"} {
+		if proxy, err := app.Find(path); err != nil || proxy.Target() != target {
+			t.Errorf("Expected %s to forward to %s, got %v %v", path, target, proxy, err)
+		}
+	}
+	if n := strings.Count(logs.String(), "config: skipping"); n != 3 {
+		t.Errorf("Expected 3 skipped entries logged, got %q", logs.String())
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
@@ -9,60 +12,566 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+var (
+	ErrNotFound      = errors.New("proxy not found")
+	ErrAlreadyExists = errors.New("proxy already exists")
+)
+
 type DataStore interface {
 	Register(string, string) error
+	RegisterWithOptions(string, string, ProxyOptions) error
+	Update(string, string) error
+	UpdateWithOptions(string, string, ProxyOptions) error
+	RegisterGroup(string, ProxyDefaults)
+	Groups() map[string]ProxyDefaults
 	Unregister(string) error
+	Rename(string, string) error
+	ReplaceAll(map[string]*Proxy) error
 	ProxyList() map[string]*Proxy
 	Find(string) (*Proxy, error)
+	FindHost(string) (string, bool)
+}
+
+// ProxyDefaults are the options a proxy inherits from its group unless it
+// sets them itself.
+type ProxyDefaults struct {
+	Timeout    time.Duration
+	Headers    map[string]string
+	HealthPath string
+}
+
+// merge fills the unset fields of d from defaults. Headers are combined, with
+// the proxy's own values winning.
+func (d ProxyDefaults) merge(defaults ProxyDefaults) ProxyDefaults {
+	if d.Timeout == 0 {
+		d.Timeout = defaults.Timeout
+	}
+	if d.HealthPath == "" {
+		d.HealthPath = defaults.HealthPath
+	}
+	if len(defaults.Headers) > 0 {
+		headers := make(map[string]string)
+		for k, v := range defaults.Headers {
+			headers[k] = v
+		}
+		for k, v := range d.Headers {
+			headers[k] = v
+		}
+		d.Headers = headers
+	}
+	return d
+}
+
+type ProxyOptions struct {
+	Group string
+	ProxyDefaults
+
+	// DebugBody logs a truncated copy of request bodies whose content type is
+	// in DebugBodyTypes, up to DebugBodyLimit bytes.
+	DebugBody      bool
+	DebugBodyTypes []string
+	DebugBodyLimit int
+
+	// Retries is how many times an idempotent request is retried when the
+	// upstream can't be reached, overriding App.Retries; -1 disables
+	// retries. RetryBudget overrides the app-wide budget.
+	Retries     int
+	RetryBudget *RetryBudget `json:"-"`
+
+	// Balancer chooses among Backends when a proxy has more than one. Config,
+	// the API and the FileStore set it through BalancerSpec instead.
+	Balancer     Balancer      `json:"-"`
+	BalancerSpec *BalancerSpec `json:"Balancer,omitempty"`
+
+	// UpstreamProxy is an HTTP proxy URL that all of this proxy's upstream
+	// connections go through, regardless of HTTP_PROXY.
+	UpstreamProxy string
+
+	// ContentLength sets how responses are framed; ContentLengthLimit caps
+	// how much is buffered to compute a missing Content-Length.
+	ContentLength      ContentLengthPolicy
+	ContentLengthLimit int64
+
+	// CanaryTarget receives requests whose CanaryHeader (X-Canary by default)
+	// matches CanaryValue, or is set at all when CanaryValue is empty.
+	CanaryTarget string
+	CanaryHeader string
+	CanaryValue  string
+
+	// DecompressRequest decodes gzip request bodies for upstreams that
+	// can't. Bodies that decode to more than MaxDecompressedBytes, 10MiB by
+	// default, get a 413.
+	DecompressRequest    bool
+	MaxDecompressedBytes int64
+
+	// MaxResponseBytes caps the size of upstream response bodies.
+	MaxResponseBytes int64
+
+	// MethodRewrite maps inbound methods to the method sent upstream. A HEAD
+	// sent upstream as GET still gets a bodiless response.
+	MethodRewrite map[string]string
+
+	// PreserveHost forwards the client's Host header instead of the
+	// target's. Requests for hosts outside a non-empty AllowedHosts get a 421.
+	PreserveHost bool
+	AllowedHosts []string
+
+	// Hosts routes requests whose Host header names one of these hostnames
+	// to the proxy, outside ProxyPrefix and with their path unchanged.
+	Hosts []string
+
+	// HMACSecret signs proxied requests over their method, path and body.
+	// The signature is sent in HMACHeader, X-Signature by default.
+	HMACSecret string
+	HMACHeader string
+
+	// AdaptiveConcurrency sheds requests with a 503 once the backend's
+	// latency suggests it is saturated. See AdaptiveLimiter.
+	AdaptiveConcurrency bool
+
+	// CacheTTL caches successful GET responses for this long. Identical
+	// concurrent misses share one upstream request.
+	CacheTTL time.Duration
+
+	// IdempotencyTTL replays the response to a request carrying an
+	// Idempotency-Key for this long to later requests with the same key,
+	// method and URI, instead of sending them upstream again.
+	IdempotencyTTL time.Duration
+
+	// StaleOnError serves an expired cached response, with a Warning
+	// header, when the upstream fails or returns a 5xx.
+	StaleOnError bool
+
+	// UnexpectedBody sets what happens to bodies sent with GET, HEAD or
+	// DELETE.
+	UnexpectedBody UnexpectedBodyPolicy
+
+	// AllowRequestHeaders, when set, is the only client headers forwarded.
+	AllowRequestHeaders []string
+
+	// ServerTiming sends the full request duration in a Server-Timing
+	// trailer after the body. Responses are always chunked, overriding
+	// ContentLength.
+	ServerTiming bool
+
+	// LowercasePath lowercases the forwarded path for case-sensitive
+	// upstreams. The query string keeps its case.
+	LowercasePath bool
+
+	// RewriteRedirects maps Location headers pointing at a backend, or at an
+	// absolute path on it, back under the proxy's path. RewriteCookies does
+	// the same for the Domain and Path of Set-Cookie.
+	RewriteRedirects bool
+	RewriteCookies   bool
+
+	// Transformers rewrite upstream responses in order, after the built-in
+	// response options and before the response is framed.
+	Transformers []ResponseTransformer `json:"-"`
+
+	// ExpiresAt, when set, is when the proxy stops routing and is swept.
+	ExpiresAt time.Time
+
+	// GeoHeaders maps geo headers set by a CDN in front of reverser to the
+	// names forwarded upstream, ex {"CF-IPCountry": "X-Geo-Country"}. See
+	// CDNGeoHeaders.
+	GeoHeaders map[string]string
+
+	// PathRewrites rewrite the forwarded path before it is appended to the
+	// target's path. The first matching rewrite applies.
+	PathRewrites []PathRewrite
+
+	// MaintenanceWindows are recurring times the proxy serves the
+	// maintenance page, ex nightly deploys.
+	MaintenanceWindows []MaintenanceWindow
+
+	// BufferBody reads request bodies in full before forwarding, so retries
+	// can replay them. Bodies over BufferMemoryLimit (1MB by default) are
+	// spooled to a temporary file.
+	BufferBody        bool
+	BufferMemoryLimit int64
+
+	// QueryToHeader moves query parameters into request headers, ex
+	// {"api_key": "X-API-Key"}. The parameters aren't forwarded.
+	QueryToHeader map[string]string
+
+	// FollowRedirects follows upstream redirects instead of returning them,
+	// up to MaxRedirects hops (10 by default). A redirect loop gets a 508.
+	FollowRedirects bool
+	MaxRedirects    int
+
+	// StripHopHeaders are removed before forwarding on top of
+	// DefaultHopHeaders. PreserveHeaders are forwarded even when they are
+	// among the defaults, ex Proxy-Authorization for an upstream that needs it.
+	StripHopHeaders []string
+	PreserveHeaders []string
 }
 
+// Proxy is not modified once it is stored; updates store a new one. Its
+// mutable state lives behind Stats, Limiter and the caches, which do their
+// own locking, and health is kept in App.Health, so the proxies ProxyList
+// hands out are safe to read while requests and health checks run.
 type Proxy struct {
-	Path string
-	URL  *url.URL
+	Path     string
+	URL      *url.URL
+	Backends []*url.URL
+	Canary   *url.URL
+	Stats    *ProxyStats
+	Limiter  *AdaptiveLimiter
+	Cache    *ResponseCache
+	// Idempotency holds the responses replayed for IdempotencyTTL.
+	Idempotency *ResponseCache
+	ProxyOptions
+
+	roundRobin *RoundRobinBalancer
+	rewrites   []compiledRewrite
+}
+
+// Static reports whether the proxy serves a local directory (a file:// target)
+// rather than forwarding to an upstream.
+func (p *Proxy) Static() bool {
+	return p.URL.Scheme == "file"
+}
+
+// FileHandler serves the directory named by a file:// target.
+func (p *Proxy) FileHandler() http.Handler {
+	return http.FileServer(http.Dir(p.URL.Path))
+}
+
+// Direct rewrites req to be sent to the proxy's upstream.
+func (p *Proxy) Direct(req *http.Request) {
+	target := p.backend(req)
+	host := req.Host
+	if !p.PreserveHost {
+		req.Host = hostHeader(target)
+	}
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	p.rewritePath(req)
+	if p.LowercasePath {
+		req.URL.Path = strings.ToLower(req.URL.Path)
+		req.URL.RawPath = strings.ToLower(req.URL.RawPath)
+	}
+	prefixPath(req, target)
+	geo := p.geoHeaders(req.Header)
+	p.filterRequestHeaders(req)
+	p.stripHopHeaders(req)
+	setForwardedHeaders(req, host)
+	p.rewriteMethod(req)
+	setClientCertHeaders(req)
+	p.moveQueryToHeaders(req)
+	for name, value := range geo {
+		req.Header.Set(name, value)
+	}
+	for name, value := range p.Headers {
+		req.Header.Set(name, value)
+	}
+	p.signRequest(req)
+}
+
+// ModifyResponse applies the proxy's response options to upstream responses.
+// Upgrade responses are passed through untouched, since their body is the
+// upgraded connection itself.
+func (p *Proxy) ModifyResponse(res *http.Response) error {
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		return nil
+	}
+	return p.responseChain().Transform(res)
 }
 
 func (p *Proxy) Handler() *httputil.ReverseProxy {
 	return &httputil.ReverseProxy{
-		Director: func(req *http.Request) {
-			req.Host = p.URL.Host
-			req.URL.Scheme = p.URL.Scheme
-			req.URL.Host = p.URL.Host
-		},
+		Director:       p.Direct,
+		ModifyResponse: p.ModifyResponse,
 	}
 }
 
 type Store struct {
 	sync.Mutex
-	store map[string]*Proxy
+	store  map[string]*Proxy
+	groups map[string]ProxyDefaults
+
+	// MaxProxies caps the number of registered proxies, 0 for no limit.
+	// Eviction sets what happens to registrations past it.
+	MaxProxies int
+	Eviction   EvictionPolicy
+
+	clock    uint64
+	accessed map[string]uint64
+	onRemove func(*Proxy, RemovalReason)
+
+	// hosts indexes the paths of proxies by the lowercased entries of their
+	// Hosts.
+	hosts map[string]map[string]bool
+}
+
+// RemovalReason is why a proxy left a Store.
+type RemovalReason int
+
+const (
+	RemovedByUnregister RemovalReason = iota
+	RemovedByEviction
+	RemovedByRename
+)
+
+// RemovalNotifier is implemented by stores that report proxies leaving them.
+type RemovalNotifier interface {
+	NotifyRemoval(func(*Proxy, RemovalReason))
+}
+
+// NotifyRemoval sets fn to be called with each proxy that leaves the store,
+// or moves away from its path on Rename. fn runs under the store's lock and
+// must not use the store.
+func (s *Store) NotifyRemoval(fn func(*Proxy, RemovalReason)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onRemove = fn
+}
+
+// removed reports a proxy leaving the store. The lock must be held.
+func (s *Store) removed(proxy *Proxy, reason RemovalReason) {
+	if s.onRemove != nil {
+		s.onRemove(proxy, reason)
+	}
 }
 
 func (s *Store) Register(target string, path string) error {
+	return s.RegisterWithOptions(target, path, ProxyOptions{})
+}
+
+// RegisterWithOptions adds a proxy at a free path. Registering a path that
+// is taken fails with ErrAlreadyExists; use Update to replace a proxy.
+func (s *Store) RegisterWithOptions(target string, path string, opts ProxyOptions) error {
+	path = NormalizePath(path)
+	if err := ValidatePath(path); err != nil {
+		return err
+	}
 	s.Lock()
 	defer s.Unlock()
-	targetURL, err := url.Parse(target)
+	if _, ok := s.store[path]; ok {
+		return alreadyRegisteredError(path)
+	}
+	proxy, err := newProxy(target, path, opts)
 	if err != nil {
 		return err
 	}
-	s.store[path] = &Proxy{
-		Path: path,
-		URL:  targetURL,
+	if err := s.makeRoom(path); err != nil {
+		return err
+	}
+	s.put(path, proxy)
+	s.touch(path)
+	return nil
+}
+
+// Update points the proxy registered at path at a new target, keeping its
+// options and counters. The entry is swapped in place, so requests never see
+// the path unregistered.
+func (s *Store) Update(target string, path string) error {
+	s.Lock()
+	defer s.Unlock()
+	existing, ok := s.store[path]
+	if !ok {
+		return fmt.Errorf("path %s: %w", path, ErrNotFound)
+	}
+	return s.replace(existing, target, existing.ProxyOptions)
+}
+
+// UpdateWithOptions replaces the proxy registered at path. Its counters carry
+// over to the new target.
+func (s *Store) UpdateWithOptions(target string, path string, opts ProxyOptions) error {
+	s.Lock()
+	defer s.Unlock()
+	existing, ok := s.store[path]
+	if !ok {
+		return fmt.Errorf("path %s: %w", path, ErrNotFound)
 	}
+	return s.replace(existing, target, opts)
+}
+
+// replace swaps existing for a proxy to target with opts. The lock must be
+// held.
+func (s *Store) replace(existing *Proxy, target string, opts ProxyOptions) error {
+	proxy, err := newProxy(target, existing.Path, opts)
+	if err != nil {
+		return err
+	}
+	proxy.Stats = existing.Stats
+	s.put(existing.Path, proxy)
+	s.touch(existing.Path)
 	return nil
 }
 
+// alreadyRegisteredError reports a taken path. It matches ErrAlreadyExists
+// with errors.Is.
+type alreadyRegisteredError string
+
+func (e alreadyRegisteredError) Error() string {
+	return fmt.Sprintf("path %q is already registered", string(e))
+}
+
+func (e alreadyRegisteredError) Is(target error) bool {
+	return target == ErrAlreadyExists
+}
+
+// newProxy validates target and opts and builds the proxy with fresh
+// runtime state.
+func newProxy(target string, path string, opts ProxyOptions) (*Proxy, error) {
+	targets, err := ParseTargets(target)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UpstreamProxy != "" {
+		if _, err := url.Parse(opts.UpstreamProxy); err != nil {
+			return nil, err
+		}
+	}
+	var canary *url.URL
+	if opts.CanaryTarget != "" {
+		if canary, err = url.Parse(opts.CanaryTarget); err != nil {
+			return nil, err
+		}
+		if err := validateTarget(canary); err != nil {
+			return nil, err
+		}
+	}
+	if err := opts.BalancerSpec.validate(); err != nil {
+		return nil, err
+	}
+	for _, window := range opts.MaintenanceWindows {
+		if err := window.validate(); err != nil {
+			return nil, err
+		}
+	}
+	rewrites, err := compileRewrites(opts.PathRewrites)
+	if err != nil {
+		return nil, err
+	}
+	var limiter *AdaptiveLimiter
+	if opts.AdaptiveConcurrency {
+		limiter = NewAdaptiveLimiter()
+	}
+	var cache *ResponseCache
+	if opts.CacheTTL > 0 {
+		cache = NewResponseCache()
+	}
+	var idempotency *ResponseCache
+	if opts.IdempotencyTTL > 0 {
+		idempotency = NewResponseCache()
+	}
+	return &Proxy{
+		Path:         path,
+		URL:          targets[0],
+		Backends:     targets,
+		Canary:       canary,
+		Stats:        &ProxyStats{},
+		Limiter:      limiter,
+		Cache:        cache,
+		Idempotency:  idempotency,
+		ProxyOptions: opts,
+		roundRobin:   &RoundRobinBalancer{},
+		rewrites:     rewrites,
+	}, nil
+}
+
+// RegisterGroup sets the defaults inherited by every proxy in the named group.
+func (s *Store) RegisterGroup(name string, defaults ProxyDefaults) {
+	s.Lock()
+	defer s.Unlock()
+	s.groups[name] = defaults
+}
+
+func (s *Store) Groups() map[string]ProxyDefaults {
+	s.Lock()
+	defer s.Unlock()
+	groups := make(map[string]ProxyDefaults, len(s.groups))
+	for name, defaults := range s.groups {
+		groups[name] = defaults
+	}
+	return groups
+}
+
+// withGroup returns the proxy with its group defaults merged in. The stored
+// proxy is left untouched so a later RegisterGroup still applies.
+func (s *Store) withGroup(proxy *Proxy) *Proxy {
+	defaults, ok := s.groups[proxy.Group]
+	if proxy.Group == "" || !ok {
+		return proxy
+	}
+	merged := *proxy
+	merged.ProxyDefaults = proxy.ProxyDefaults.merge(defaults)
+	return &merged
+}
+
 func (s *Store) Unregister(path string) error {
 	s.Lock()
 	defer s.Unlock()
-	if _, ok := s.store[path]; !ok {
-		return errors.New(fmt.Sprintf("Path %s is not registered", path))
+	proxy, ok := s.store[path]
+	if !ok {
+		return fmt.Errorf("path %s: %w", path, ErrNotFound)
+	}
+	s.drop(path)
+	s.removed(proxy, RemovedByUnregister)
+	return nil
+}
+
+// Rename moves a proxy to a new path under a single lock, keeping its options
+// and runtime state, so there is no window where neither path resolves.
+func (s *Store) Rename(oldPath string, newPath string) error {
+	newPath = NormalizePath(newPath)
+	if err := ValidatePath(newPath); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	proxy, ok := s.store[oldPath]
+	if !ok {
+		return fmt.Errorf("path %s: %w", oldPath, ErrNotFound)
+	}
+	if _, ok := s.store[newPath]; ok {
+		return fmt.Errorf("path %s: %w", newPath, ErrAlreadyExists)
+	}
+	renamed := *proxy
+	renamed.Path = newPath
+	s.put(newPath, &renamed)
+	s.accessed[newPath] = s.accessed[oldPath]
+	s.drop(oldPath)
+	s.removed(proxy, RemovedByRename)
+	return nil
+}
+
+// ReplaceAll swaps the registered proxies for proxies, keyed by path, under a
+// single lock: paths missing from it are unregistered, changed proxies are
+// replaced with their counters carried over, and unchanged ones are kept as
+// they are. When proxies don't fit under MaxProxies nothing changes.
+func (s *Store) ReplaceAll(proxies map[string]*Proxy) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.MaxProxies > 0 && len(proxies) > s.MaxProxies {
+		return fmt.Errorf("%d proxies to register: %w", len(proxies), ErrStoreFull)
+	}
+	for path, existing := range s.store {
+		if _, ok := proxies[path]; !ok {
+			s.drop(path)
+			s.removed(existing, RemovedByUnregister)
+		}
+	}
+	for path, proxy := range proxies {
+		if existing, ok := s.store[path]; ok {
+			if sameProxy(existing, proxy) {
+				continue
+			}
+			proxy.Stats = existing.Stats
+		}
+		s.put(path, proxy)
+		s.touch(path)
 	}
-	delete(s.store, path)
 	return nil
 }
 
@@ -72,7 +581,8 @@ func (s *Store) Find(path string) (*Proxy, error) {
 	if _, ok := s.store[path]; !ok {
 		return nil, errors.New(fmt.Sprintf("Path %s not found", path))
 	}
-	return s.store[path], nil
+	s.touch(path)
+	return s.withGroup(s.store[path]), nil
 }
 
 func (s *Store) ProxyList() map[string]*Proxy {
@@ -80,52 +590,358 @@ func (s *Store) ProxyList() map[string]*Proxy {
 	defer s.Unlock()
 	result := make(map[string]*Proxy)
 	for k, v := range s.store {
-		result[k] = v
+		result[k] = s.withGroup(v)
 	}
 	return result
 }
 
+// put stores proxy at path, replacing any proxy there, and keeps the host
+// index in step. The lock must be held.
+func (s *Store) put(path string, proxy *Proxy) {
+	if existing, ok := s.store[path]; ok {
+		s.indexHosts(existing, false)
+	}
+	s.store[path] = proxy
+	s.indexHosts(proxy, true)
+}
+
+// drop removes the proxy at path and its entries in the indexes. The lock
+// must be held.
+func (s *Store) drop(path string) {
+	if existing, ok := s.store[path]; ok {
+		s.indexHosts(existing, false)
+	}
+	delete(s.store, path)
+	delete(s.accessed, path)
+}
+
 func NewStore() *Store {
-	return &Store{store: make(map[string]*Proxy)}
+	return &Store{store: make(map[string]*Proxy), groups: make(map[string]ProxyDefaults), accessed: make(map[string]uint64), hosts: make(map[string]map[string]bool)}
 }
 
 type AppInterface interface {
 	DataStore
 	ExecuteTemplate(io.Writer, string, interface{}) error
+	Link(string) string
+	HealthSnapshot() map[string]ProxyHealth
+	Endpoints() []Endpoint
+	Audit(r *http.Request, action string, path string, oldTarget string, newTarget string)
+	CSRFToken(w http.ResponseWriter, r *http.Request) string
 }
 type App struct {
 	DataStore
-	Router   *mux.Router
-	Template *template.Template
+	Router        *mux.Router
+	Template      *template.Template
+	Transport     http.RoundTripper
+	RetryBudget   *RetryBudget
+	Authenticator Authenticator
+	Health        *Health
+	Logger        *log.Logger
+
+	// ProxyPrefix is the path proxies are mounted under, /proxy/ by default.
+	ProxyPrefix string
+
+	// RequestTimeout bounds upstream requests for proxies that don't set
+	// their own Timeout.
+	RequestTimeout time.Duration
+
+	// Retries is how many times proxies without their own Retries retry
+	// idempotent requests that couldn't reach the upstream.
+	Retries int
+
+	// BasePath prefixes every route and generated link, for running behind
+	// another proxy at a subpath. It must be set before Setup.
+	BasePath string
+
+	// Via is the pseudonym added to the Via header of proxied requests and
+	// responses. Empty disables it.
+	Via string
+
+	// ListenAddr is the address reverser serves on. Targets pointing back at
+	// it are warned about, or rejected when Strict is set.
+	ListenAddr string
+	Strict     bool
+
+	// AdminHost is the host name the admin UI and API are reached on. It,
+	// and the listen address's own names, can't be claimed by a proxy's
+	// Hosts.
+	AdminHost string
+
+	// SpoolDir is where buffered request bodies too large for memory are
+	// spooled, the system temporary directory when empty.
+	SpoolDir string
+
+	// Failures keeps recent failed proxied requests for /api/failures. Nil
+	// disables it.
+	Failures *FailureLog
+
+	// AccessLog records every proxied request. Nil disables it.
+	AccessLog *AccessLog
+
+	// AuditLog records every change to the registered proxies. Nil
+	// disables it.
+	AuditLog *AuditLog
+
+	// MetricsNamespace and MetricsSubsystem prefix the names of exported
+	// metrics, ex reverser_in_flight_requests.
+	MetricsNamespace string
+	MetricsSubsystem string
+
+	// MaxPathLength caps the length of proxy paths at registration and of
+	// proxied request paths, which get a 414 past it. 0 for no limit.
+	MaxPathLength int
+
+	// DefaultScheme is prefixed to registered targets without one, so
+	// backend:8080 means http://backend:8080. Empty rejects them.
+	DefaultScheme string
+
+	// MutationLimiter caps how often admin requests may change state. Nil
+	// leaves them unlimited.
+	MutationLimiter *RateLimiter
+
+	// Readiness sets whether /readyz needs any or all backends healthy.
+	Readiness ReadinessPolicy
+
+	maintenance    int32
+	loading        int32
+	transports     map[string]*proxyTransport
+	handlers       map[string]*cachedHandler
+	transportsLock sync.Mutex
 }
 
 func (app *App) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	if viewContext, ok := data.(map[string]interface{}); ok {
+		viewContext["BasePath"] = app.BasePath
+		viewContext["ProxyPrefix"] = app.ProxyPrefix
+	}
 	return app.Template.ExecuteTemplate(w, name, data)
 }
 
+// Link returns path prefixed with the app's base path.
+func (app *App) Link(path string) string {
+	return app.BasePath + path
+}
+
+// NormalizeBasePath turns "reverser/" or "/reverser/" into "/reverser", and
+// "/" into "".
+func NormalizeBasePath(basePath string) string {
+	basePath = strings.Trim(basePath, "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
 type RouteHandler func(AppInterface) http.HandlerFunc
 
 func (app *App) RegisterHandler(path string, handler RouteHandler) {
-	app.Router.HandleFunc(path, handler(app))
+	app.Router.Handle(app.Link(path), SecurityHeaders(app.requireAuth(app.throttleMutations(handler(app)))))
 }
 
 func (app *App) MountProxyHandler() {
+	app.Router.PathPrefix(app.Link(app.ProxyPrefix)).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.serveProxy(w, r, app.resolve)
+	})
+}
 
-	app.Router.PathPrefix("/proxy/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		parts := strings.Split(r.URL.Path, "/")
-		proxyId := parts[2]
-		proxy, err := app.Find(proxyId)
-		if err != nil {
-			http.NotFound(w, r)
+// serveProxy forwards r to the proxy resolve finds for it, stripping the
+// prefix resolve returns.
+func (app *App) serveProxy(w http.ResponseWriter, r *http.Request, resolve func(*http.Request) (*Proxy, string, error)) {
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	var proxy *Proxy
+	if app.AccessLog != nil {
+		received := time.Now()
+		defer func() { app.AccessLog.Log(r, proxy, sw, time.Since(received)) }()
+	}
+	defer func() {
+		if proxy != nil {
+			proxy.Stats.CountStatus(sw.Status())
+		}
+	}()
+	if app.MaxPathLength > 0 && len(r.URL.Path) > app.MaxPathLength {
+		http.Error(w, http.StatusText(http.StatusRequestURITooLong), http.StatusRequestURITooLong)
+		return
+	}
+	if !app.Ready() {
+		renderNotReady(w)
+		return
+	}
+	if app.Maintenance() {
+		app.renderMaintenance(w)
+		return
+	}
+	proxy, prefix, err := resolve(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if proxy.Expired(time.Now()) {
+		renderGone(w)
+		return
+	}
+	if proxy.InMaintenance(time.Now()) {
+		app.renderMaintenance(w)
+		return
+	}
+	if !proxy.hostAllowed(r.Host) {
+		http.Error(w, http.StatusText(http.StatusMisdirectedRequest), http.StatusMisdirectedRequest)
+		return
+	}
+	if err := proxy.checkBody(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if proxy.DecompressRequest {
+		if err := decompressRequest(r, proxy.decompressLimit()); err == errDecompressedTooLarge {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		http.StripPrefix(fmt.Sprintf("/proxy/%s", proxyId), proxy.Handler()).ServeHTTP(w, r)
-	})
+	}
+	if proxy.DebugBody {
+		app.logRequestBody(proxy, r)
+	}
+	if proxy.BufferBody && r.ContentLength != 0 {
+		spool, err := app.bufferBody(proxy, r)
+		if _, ok := err.(*spoolError); ok {
+			app.Logger.Printf("proxy %s: %s", proxy.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer spool.Close()
+	}
+	if timeout := app.timeoutFor(proxy); timeout > 0 && !isUpgrade(r) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	if len(proxy.MethodRewrite) > 0 {
+		r = withInboundMethod(r)
+	}
+	start := time.Now()
+	if proxy.Limiter != nil {
+		if !proxy.Limiter.Acquire() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		defer func() {
+			if sw.err != nil || sw.Status() >= 500 {
+				proxy.Limiter.Drop()
+				return
+			}
+			proxy.Limiter.Release(time.Since(start))
+		}()
+	}
+	proxy.Stats.Begin()
+	defer func() { proxy.Stats.End(time.Since(start)) }()
+	defer app.recordFailure(proxy, r, sw)
+	if proxy.ServerTiming {
+		announceServerTiming(sw)
+	}
+	if proxy.RewriteRedirects || proxy.RewriteCookies {
+		r = withProxyPrefix(r, prefix)
+	}
+	http.StripPrefix(prefix, app.handlerFor(proxy)).ServeHTTP(sw, r)
+	if proxy.ServerTiming {
+		setServerTiming(sw, time.Since(start))
+	}
 }
 
-func NewApp(template *template.Template, store DataStore) *App {
+// resolve finds the proxy a request under ProxyPrefix is addressed to, along with the
+// path prefix to strip before forwarding.
+func (app *App) resolve(r *http.Request) (*Proxy, string, error) {
+	rest := strings.TrimPrefix(r.URL.Path, app.Link(app.ProxyPrefix))
+	proxyId := strings.SplitN(rest, "/", 2)[0]
+	if proxyId == "" {
+		return nil, "", fmt.Errorf("no proxy id in %s: %w", r.URL.Path, ErrNotFound)
+	}
+	proxy, err := app.Find(proxyId)
+	if err != nil {
+		return nil, "", err
+	}
+	return proxy, app.Link(app.ProxyPrefix + proxyId), nil
+}
+
+// ResolveAndDirect looks up the proxy for r and rewrites r as it would be sent
+// upstream, without sending it. It lets routing overhead be measured
+// in-process.
+func (app *App) ResolveAndDirect(r *http.Request) (*Proxy, error) {
+	proxy, prefix, err := app.resolve(r)
+	if err != nil {
+		return nil, err
+	}
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	r.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+	app.balanced(proxy).Direct(r)
+	return proxy, nil
+}
+
+func (app *App) proxyHandler(proxy *Proxy) http.Handler {
+	if proxy.Static() {
+		return proxy.FileHandler()
+	}
+	handler := app.balanced(proxy).Handler()
+	handler.Transport = app.transportFor(proxy)
+	if proxy.FollowRedirects {
+		max := proxy.MaxRedirects
+		if max <= 0 {
+			max = DefaultMaxRedirects
+		}
+		handler.Transport = &redirectTransport{next: handler.Transport, max: max}
+	}
+	if retries := app.retriesFor(proxy); retries > 0 {
+		budget := proxy.RetryBudget
+		if budget == nil {
+			budget = app.RetryBudget
+		}
+		handler.Transport = &retryTransport{next: handler.Transport, retries: retries, budget: budget, backoff: DefaultRetryBackoff}
+	}
+	if proxy.Idempotency != nil {
+		handler.Transport = &idempotencyTransport{next: handler.Transport, cache: proxy.Idempotency, ttl: proxy.IdempotencyTTL}
+	}
+	if proxy.Cache != nil {
+		handler.Transport = &cacheTransport{next: handler.Transport, cache: proxy.Cache, ttl: proxy.CacheTTL, staleOnError: proxy.StaleOnError, keyHeaders: proxy.queryHeaders()}
+	}
+	if app.Via != "" {
+		direct, modifyResponse := handler.Director, handler.ModifyResponse
+		handler.Director = func(req *http.Request) {
+			direct(req)
+			appendVia(req.Header, req.ProtoMajor, req.ProtoMinor, app.Via)
+		}
+		handler.ModifyResponse = func(res *http.Response) error {
+			appendVia(res.Header, res.ProtoMajor, res.ProtoMinor, app.Via)
+			return modifyResponse(res)
+		}
+	}
+	handler.ErrorHandler = app.proxyErrorHandler(proxy)
+	handler.ErrorLog = app.Logger
+	if len(proxy.PreserveHeaders) > 0 {
+		handler.Transport = &preserveHeadersTransport{next: handler.Transport}
+		return preserveHeaders(handler, proxy.PreserveHeaders)
+	}
+	return handler
+}
+
+func NewApp(template *template.Template, store DataStore, opts ...Option) *App {
 	router := mux.NewRouter()
-	return &App{Router: router, Template: template, DataStore: store}
+	transport := NewTransport(NewDialer(DefaultKeepAlive))
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	budget := NewRetryBudget(DefaultRetryRatio, DefaultMinRetries, DefaultRetryWindow)
+	app := &App{Router: router, Template: template, DataStore: store, Transport: transport, RetryBudget: budget, Health: NewHealth(), Logger: logger, Via: DefaultVia, ProxyPrefix: DefaultProxyPrefix, MetricsNamespace: DefaultMetricsNamespace, MaxPathLength: DefaultMaxPathLength}
+	if notifier, ok := store.(RemovalNotifier); ok {
+		notifier.NotifyRemoval(app.proxyRemoved)
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+	return app
 }
 
 func NewViewContext() map[string]interface{} {
@@ -153,36 +969,80 @@ func (rf *RegisterForm) Submit(r *http.Request) bool {
 		return false
 	}
 
-	rf.values["Path"] = r.FormValue("path")
-	rf.values["Target"] = r.FormValue("target")
+	if wantsJSON(r) {
+		var body struct {
+			Path   string `json:"path"`
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			rf.errors = map[string]string{"Body": err.Error()}
+			return false
+		}
+		rf.values["Path"] = body.Path
+		rf.values["Target"] = body.Target
+	} else {
+		rf.values["Path"] = r.FormValue("path")
+		rf.values["Target"] = r.FormValue("target")
+	}
+	rf.values["Path"] = NormalizePath(rf.values["Path"])
 
 	if !rf.Valid() {
 		return false
 	}
 
-	rf.store.Register(rf.Value("Target"), rf.Value("Path"))
+	if err := rf.store.Register(rf.Value("Target"), rf.Value("Path")); err != nil {
+		if errors.Is(err, ErrAlreadyExists) {
+			rf.errors["Path"] = err.Error()
+		} else {
+			rf.errors["Target"] = err.Error()
+		}
+		return false
+	}
+	rf.registered()
 	return true
 }
 
+// registered shows the target as the store registered it, expanded and
+// normalized.
+func (rf *RegisterForm) registered() {
+	if proxy, err := rf.store.Find(rf.Value("Path")); err == nil {
+		rf.values["Target"] = proxy.Target()
+	}
+}
+
 func (rf *RegisterForm) Valid() bool {
 	rf.errors = make(map[string]string)
 
-	if rf.Value("Path") == "" {
-		rf.errors["Path"] = "Path is required"
-		return false
+	if err := ValidatePath(rf.Value("Path")); err != nil {
+		rf.errors["Path"] = err.Error()
+	} else if err := rf.checkPathLength(); err != nil {
+		rf.errors["Path"] = err.Error()
+	} else if _, err := rf.store.Find(rf.Value("Path")); err == nil {
+		rf.errors["Path"] = alreadyRegisteredError(rf.Value("Path")).Error()
 	}
 
 	if rf.Value("Target") == "" {
 		rf.errors["Target"] = "The target url is required"
-		return false
+	} else if target, err := preparedTarget(rf.store, rf.Value("Target")); err != nil {
+		rf.errors["Target"] = err.Error()
+	} else if _, err := ParseTargets(target); err != nil {
+		rf.errors["Target"] = err.Error()
 	}
 
-	if _, err := url.Parse(rf.Value("Target")); err != nil {
-		rf.errors["Target"] = err.Error()
-		return false
+	return len(rf.errors) == 0
+}
+
+// checkPathLength applies the store's path length cap, if it has one.
+func (rf *RegisterForm) checkPathLength() error {
+	if checker, ok := rf.store.(pathLengthChecker); ok {
+		return checker.checkPathLength(rf.Value("Path"))
 	}
+	return nil
+}
 
-	return true
+// ErrorsJSON serializes the form errors as {"errors":{"Field":"message"}}.
+func (rf *RegisterForm) ErrorsJSON() ([]byte, error) {
+	return json.Marshal(map[string]map[string]string{"errors": rf.errors})
 }
 
 func (rf *RegisterForm) Values() map[string]string {
@@ -197,11 +1057,92 @@ func NewRegisterForm(store DataStore) *RegisterForm {
 	return &RegisterForm{errors: make(map[string]string), values: make(map[string]string), store: store}
 }
 
+// EditForm changes the target of a registered proxy. The path can't be
+// edited; it comes from the proxy being edited.
+type EditForm struct {
+	store  DataStore
+	errors map[string]string
+	values map[string]string
+}
+
+func (ef *EditForm) Errors() map[string]string {
+	return ef.errors
+}
+
+func (ef *EditForm) Submit(r *http.Request) bool {
+	if r.Method != "POST" {
+		return false
+	}
+
+	ef.values["Target"] = r.FormValue("target")
+
+	if !ef.Valid() {
+		return false
+	}
+
+	if err := ef.store.Update(ef.Value("Target"), ef.Value("Path")); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			ef.errors["Path"] = err.Error()
+		} else {
+			ef.errors["Target"] = err.Error()
+		}
+		return false
+	}
+	ef.registered()
+	return true
+}
+
+// registered shows the target as the store updated it, expanded and
+// normalized.
+func (ef *EditForm) registered() {
+	if proxy, err := ef.store.Find(ef.Value("Path")); err == nil {
+		ef.values["Target"] = proxy.Target()
+	}
+}
+
+func (ef *EditForm) Valid() bool {
+	ef.errors = make(map[string]string)
+
+	if ef.Value("Target") == "" {
+		ef.errors["Target"] = "The target url is required"
+	} else if target, err := preparedTarget(ef.store, ef.Value("Target")); err != nil {
+		ef.errors["Target"] = err.Error()
+	} else if _, err := ParseTargets(target); err != nil {
+		ef.errors["Target"] = err.Error()
+	}
+
+	return len(ef.errors) == 0
+}
+
+func (ef *EditForm) Values() map[string]string {
+	return ef.values
+}
+
+func (ef *EditForm) Value(val string) string {
+	return ef.values[val]
+}
+
+// NewEditForm returns a form for proxy, filled in with its current target.
+func NewEditForm(store DataStore, proxy *Proxy) *EditForm {
+	values := map[string]string{"Path": proxy.Path, "Target": proxy.Target()}
+	return &EditForm{errors: make(map[string]string), values: values, store: store}
+}
+
 func (app *App) Setup() {
+	app.Router.Use(app.RecoverPanics)
+	app.MountHostHandler()
 	app.RegisterHandler("/", func(app AppInterface) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
+			if wantsJSON(r) {
+				writeJSON(w, http.StatusOK, map[string][]Endpoint{"endpoints": app.Endpoints()})
+				return
+			}
 			viewContext := NewViewContext()
-			viewContext["ProxyList"] = app.ProxyList()
+			proxyList := app.ProxyList()
+			viewContext["ProxyList"] = proxyList
+			viewContext["Empty"] = len(proxyList) == 0
+			viewContext["Health"] = app.HealthSnapshot()
+			viewContext["CSRFToken"] = app.CSRFToken(w, r)
 			viewContext["Title"] = "reverser-home"
 			app.ExecuteTemplate(w, "index.html", viewContext)
 		}
@@ -211,7 +1152,19 @@ func (app *App) Setup() {
 			viewContext := NewViewContext()
 			form := NewRegisterForm(app)
 			if form.Submit(r) {
-				http.Redirect(w, r, "/", 302)
+				app.Audit(r, "register", form.Value("Path"), "", form.Value("Target"))
+				if wantsJSON(r) {
+					writeJSON(w, http.StatusCreated, form.Values())
+					return
+				}
+				http.Redirect(w, r, app.Link("/"), 302)
+				return
+			}
+			if wantsJSON(r) {
+				body, _ := form.ErrorsJSON()
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(body)
 				return
 			}
 			viewContext["Form"] = form
@@ -219,23 +1172,211 @@ func (app *App) Setup() {
 			app.ExecuteTemplate(w, "register.html", viewContext)
 		}
 	})
+	app.RegisterHandler("/edit", func(app AppInterface) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			proxy, err := app.Find(r.URL.Query().Get("path"))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			viewContext := NewViewContext()
+			oldTarget := proxy.Target()
+			form := NewEditForm(app, proxy)
+			if form.Submit(r) {
+				app.Audit(r, "update", form.Value("Path"), oldTarget, form.Value("Target"))
+				http.Redirect(w, r, app.Link("/"), 302)
+				return
+			}
+			viewContext["Form"] = form
+			viewContext["Title"] = "reverser-edit"
+			app.ExecuteTemplate(w, "edit.html", viewContext)
+		}
+	})
 	app.RegisterHandler("/unregister", func(app AppInterface) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			app.Unregister(r.URL.Query().Get("path"))
-			http.Redirect(w, r, "/", 302)
+			if r.Method != "POST" {
+				w.Header().Set("Allow", "POST")
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			if !validCSRF(r) {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			path := r.PostFormValue("path")
+			if proxy, err := app.Find(path); err == nil {
+				if app.Unregister(path) == nil {
+					app.Audit(r, "unregister", path, proxy.Target(), "")
+				}
+			}
+			http.Redirect(w, r, app.Link("/"), 302)
 		}
 	})
 
+	app.MountAPIHandlers()
+	app.MountMaintenanceHandlers()
+	app.MountFailureHandlers()
+	app.MountImportHandler()
+	app.MountFavicon()
+	app.MountMetricsHandler()
+	app.MountReadinessHandler()
 	app.MountProxyHandler()
 
 }
 
 func main() {
-	templates := template.Must(template.ParseGlob("templates/*.html"))
-	store := NewStore()
+	keepAlive := flag.Duration("upstream-keepalive", DefaultKeepAlive, "interval between TCP keep-alive probes on upstream connections")
+	maxIdleConns := flag.Int("upstream-max-idle-conns", DefaultMaxIdleConns, "idle upstream connections kept open across all hosts, 0 for no limit")
+	maxIdleConnsPerHost := flag.Int("upstream-max-idle-conns-per-host", DefaultMaxIdleConnsPerHost, "idle upstream connections kept open per host")
+	idleConnTimeout := flag.Duration("upstream-idle-timeout", DefaultIdleConnTimeout, "how long an idle upstream connection is kept open, 0 for no limit")
+	tlsHandshakeTimeout := flag.Duration("upstream-tls-handshake-timeout", DefaultTLSHandshakeTimeout, "bound on TLS handshakes with upstreams, 0 for none")
+	fallbackDelay := flag.Duration("dial-fallback-delay", DefaultFallbackDelay, "how long to wait on one address family before also dialing the other")
+	retryRatio := flag.Float64("retry-budget", DefaultRetryRatio, "fraction of upstream requests that may be retried within a window")
+	strict := flag.Bool("strict", false, "reject proxies whose target is reverser's own listen address")
+	via := flag.String("via", DefaultVia, "pseudonym added to the Via header of proxied traffic, empty to disable")
+	healthInterval := flag.Duration("health-interval", 30*time.Second, "how often upstream health is checked, 0 to disable")
+	maintenance := flag.Bool("maintenance", false, "start with proxying paused for maintenance")
+	basePath := flag.String("base-path", "", "path prefix for all routes when served behind another proxy")
+	failureLogSize := flag.Int("failure-log-size", DefaultFailureLogSize, "number of recent failed proxied requests kept for /api/failures, 0 to disable")
+	maxProxies := flag.Int("max-proxies", 0, "maximum number of registered proxies, 0 for no limit")
+	eviction := flag.String("eviction", "reject", "what to do when -max-proxies is reached: reject new proxies or evict the least recently used (lru)")
+	storeFile := flag.String("store-file", "", "JSON file registered proxies are saved to and loaded from, in memory only when empty")
+	configFile := flag.String("config", "", "JSON config file of proxies registered at startup, in the /api/import format")
+	validateConfig := flag.String("validate-config", "", "check the proxies in a JSON config file and exit without serving")
+	addr := flag.String("addr", DefaultAddr, "address to listen on, $PORT is used when this isn't given")
+	templatesPattern := flag.String("templates", DefaultTemplates, "glob or directory of templates overriding the built-in ones by name")
+	assetsDir := flag.String("assets", "assets", "directory of static assets served under /assets/")
+	accessLog := flag.String("access-log", "text", "format of the access log of proxied requests written to stderr: text, json or off")
+	readiness := flag.String("readiness", "any", "backends that must pass health checks for /readyz to succeed: any or all")
+	retries := flag.Int("retries", 0, "times idempotent requests are retried when the upstream can't be reached, for proxies without their own Retries")
+	requestTimeout := flag.Duration("timeout", 0, "default bound on upstream requests for proxies without their own timeout, 0 for none")
+	defaultScheme := flag.String("default-scheme", "", "scheme assumed for targets registered without one (http or https), empty to reject them")
+	metricsNamespace := flag.String("metrics-namespace", DefaultMetricsNamespace, "prefix of the metrics exported on /metrics")
+	metricsSubsystem := flag.String("metrics-subsystem", "", "second prefix of exported metrics, after the namespace")
+	maxPathLength := flag.Int("max-path-length", DefaultMaxPathLength, "longest proxy path accepted at registration and request path accepted for proxying, 0 for no limit")
+	mutationRate := flag.Float64("mutation-rate", 0, "admin changes allowed per second before answering 429, 0 for no limit")
+	mutationBurst := flag.Int("mutation-burst", DefaultMutationBurst, "admin changes allowed at once under -mutation-rate")
+	tlsCert := flag.String("tls-cert", "", "certificate file to serve HTTPS with, together with -tls-key")
+	tlsKey := flag.String("tls-key", "", "private key file for -tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA certificates file to verify client certificates against; clients may still connect without one")
+	tlsAddr := flag.String("tls-addr", "", "address to serve HTTPS on alongside plain HTTP on -addr, HTTPS only on -addr when empty")
+	redirectHTTPSFlag := flag.Bool("redirect-https", false, "redirect plain HTTP requests to -tls-addr")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve the read-only gRPC API on, off when empty; needs a build with -tags grpc")
+	auditLog := flag.String("audit-log", "", "file every proxy change is appended to as JSON lines, empty to disable")
+	adminHost := flag.String("admin-host", "", "host name the admin UI and API are reached on, which proxies can't route by Hosts")
+	adminUser := flag.String("admin-user", os.Getenv("REVERSER_ADMIN_USER"), "basic auth user for the admin UI and API, $REVERSER_ADMIN_USER by default")
+	adminPass := flag.String("admin-pass", os.Getenv("REVERSER_ADMIN_PASS"), "basic auth password for the admin UI and API, $REVERSER_ADMIN_PASS by default")
+	flag.Parse()
+	addrSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "addr" {
+			addrSet = true
+		}
+	})
+	listenAddr := resolveListenAddr(*addr, addrSet, os.Getenv("PORT"))
+	listen := listenConfig{Addr: listenAddr, TLSAddr: *tlsAddr, CertFile: *tlsCert, KeyFile: *tlsKey, ClientCAFile: *tlsClientCA, RedirectHTTPS: *redirectHTTPSFlag}
+	if err := listen.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	templates := template.Must(LoadTemplates(*templatesPattern))
+	memory := NewStore()
+	var store DataStore = memory
+	if *storeFile != "" {
+		fileStore, err := NewFileStore(*storeFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		memory, store = fileStore.Store, fileStore
+	}
+	memory.MaxProxies = *maxProxies
+	evictionPolicy, err := ParseEvictionPolicy(*eviction)
+	if err != nil {
+		log.Fatal(err)
+	}
+	memory.Eviction = evictionPolicy
 	app := NewApp(templates, store)
+	dialer := NewDialer(*keepAlive)
+	dialer.FallbackDelay = *fallbackDelay
+	transport := NewTransport(dialer)
+	transport.MaxIdleConns = *maxIdleConns
+	transport.MaxIdleConnsPerHost = *maxIdleConnsPerHost
+	transport.IdleConnTimeout = *idleConnTimeout
+	transport.TLSHandshakeTimeout = *tlsHandshakeTimeout
+	app.Transport = transport
+	app.RetryBudget = NewRetryBudget(*retryRatio, DefaultMinRetries, DefaultRetryWindow)
+	app.BasePath = NormalizeBasePath(*basePath)
+	app.Via = *via
+	app.ListenAddr = listenAddr
+	app.AdminHost = *adminHost
+	app.Strict = *strict
+	app.RequestTimeout = *requestTimeout
+	app.Retries = *retries
+	app.MaxPathLength = *maxPathLength
+	if *mutationRate > 0 {
+		app.MutationLimiter = NewRateLimiter(*mutationRate, *mutationBurst)
+	}
+	app.MetricsNamespace = *metricsNamespace
+	app.MetricsSubsystem = *metricsSubsystem
+	app.Authenticator = adminAuthenticator(*adminUser, *adminPass)
+	if *validateConfig != "" {
+		os.Exit(app.validateConfigCommand(*validateConfig, os.Stdout))
+	}
+	if *failureLogSize > 0 {
+		app.Failures = NewFailureLog(*failureLogSize)
+	}
+	if *auditLog != "" {
+		app.AuditLog, err = OpenAuditLog(*auditLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *accessLog != "off" {
+		format, err := ParseAccessLogFormat(*accessLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.AccessLog = NewAccessLog(os.Stderr, format)
+	}
+	app.Readiness, err = ParseReadinessPolicy(*readiness)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.DefaultScheme, err = ParseDefaultScheme(*defaultScheme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.SetMaintenance(*maintenance)
 	app.Setup()
-	http.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("assets"))))
+	if *configFile != "" {
+		loaded := app.LoadInBackground(func() error { return app.loadConfigFile(*configFile) })
+		go func() {
+			if err := <-loaded; err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if *grpcAddr != "" {
+		go func() {
+			log.Fatal(app.ServeGRPC(*grpcAddr))
+		}()
+	}
+	if *healthInterval > 0 {
+		app.StartHealthChecks(*healthInterval, nil)
+	}
+	app.StartExpirySweeper(DefaultSweepInterval, nil)
+	http.Handle(app.Link("/assets/"), http.StripPrefix(app.Link("/assets/"), http.FileServer(http.Dir(*assetsDir))))
 	http.Handle("/", app.Router)
-	log.Fatal(http.ListenAndServe(":8000", nil))
+	log.Fatal(listen.serve(http.DefaultServeMux))
+}
+
+const DefaultAddr = ":8000"
+
+// resolveListenAddr picks the listen address: an explicit -addr wins, then
+// $PORT as PaaS platforms set it, then the -addr default.
+func resolveListenAddr(addr string, addrSet bool, port string) string {
+	if !addrSet && port != "" {
+		return ":" + port
+	}
+	return addr
 }
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Subject() *App {
-	templates := template.Must(template.ParseGlob("templates/*.html"))
+	templates := template.Must(LoadTemplates(""))
 	store := NewStore()
 	app := NewApp(templates, store)
 	app.Setup()
@@ -29,43 +38,574 @@ func TestProxyPass(t *testing.T) {
 		"/proxy/testing/?foo=bar":      "/?foo=bar, POST",
 	}
 
+	h := NewTestHarness(t, map[string]http.Handler{
+		"testing": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(fmt.Sprintf("%s, %s", r.URL, r.Method)))
+		}),
+	})
+
+	for path, expected := range getData {
+		if _, content := h.Get(path); content != expected {
+			t.Errorf("Expected %s, got %s", expected, content)
+		}
+	}
+	for path, expected := range postData {
+		if _, content := h.Do("POST", path, nil); content != expected {
+			t.Errorf("Expected %s, got %s", expected, content)
+		}
+	}
+}
+
+func TestGroupDefaults(t *testing.T) {
+	store := NewStore()
+	store.RegisterGroup("internal", ProxyDefaults{
+		Timeout:    5 * time.Second,
+		Headers:    map[string]string{"X-Team": "core", "X-Env": "prod"},
+		HealthPath: "/health",
+	})
+	store.RegisterWithOptions("http://localhost:9000", "inherits", ProxyOptions{Group: "internal"})
+	store.RegisterWithOptions("http://localhost:9001", "overrides", ProxyOptions{
+		Group: "internal",
+		ProxyDefaults: ProxyDefaults{
+			Timeout: time.Second,
+			Headers: map[string]string{"X-Env": "staging"},
+		},
+	})
+
+	proxy, err := store.Find("inherits")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy.Timeout != 5*time.Second {
+		t.Errorf("Expected inherited timeout %s, got %s", 5*time.Second, proxy.Timeout)
+	}
+	if proxy.HealthPath != "/health" {
+		t.Errorf("Expected inherited health path /health, got %s", proxy.HealthPath)
+	}
+
+	proxy, err = store.Find("overrides")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy.Timeout != time.Second {
+		t.Errorf("Expected overridden timeout %s, got %s", time.Second, proxy.Timeout)
+	}
+	if proxy.HealthPath != "/health" {
+		t.Errorf("Expected inherited health path /health, got %s", proxy.HealthPath)
+	}
+	if proxy.Headers["X-Env"] != "staging" || proxy.Headers["X-Team"] != "core" {
+		t.Errorf("Expected merged headers, got %v", proxy.Headers)
+	}
+}
+
+func TestStaticProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
 	app := Subject()
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(fmt.Sprintf("%s, %s", r.URL, r.Method)))
-	}))
+	app.Register("file://"+filepath.ToSlash(dir), "static")
+	proxy, _ := app.Find("static")
+	if !proxy.Static() {
+		t.Error("Expected file target to register a static proxy")
+	}
+	server := httptest.NewServer(app.Router)
 	defer server.Close()
-	app.Register(server.URL, "testing")
-	proxy := httptest.NewServer(app.Router)
+
+	res, err := http.Get(server.URL + "/proxy/static/hello.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(content) != "hello" {
+		t.Errorf("Expected 200 hello, got %d %s", res.StatusCode, content)
+	}
+}
+
+func TestRegisterJSONErrors(t *testing.T) {
+	app := Subject()
+	server := httptest.NewServer(app.Router)
 	defer server.Close()
 
-	for path, expected := range getData {
+	res, err := http.Post(server.URL+"/register", "application/json", strings.NewReader(`{"path":"","target":""}`))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+	var body struct {
+		Errors map[string]string `json:"errors"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	for _, field := range []string{"Path", "Target"} {
+		if body.Errors[field] == "" {
+			t.Errorf("Expected an error for %s, got %v", field, body.Errors)
+		}
+	}
 
-		res, err := http.Get(proxy.URL + path)
-		if err != nil {
-			t.Errorf("Unexpected error %s", err)
+	res, err = http.Post(server.URL+"/register", "application/json", strings.NewReader(`{"path":"api","target":"http://localhost:9000"}`))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, res.StatusCode)
+	}
+	if _, err := app.Find("api"); err != nil {
+		t.Errorf("Expected the proxy to be registered, got %s", err)
+	}
+}
+
+func TestRegisterFormCollectsAllErrors(t *testing.T) {
+	form := NewRegisterForm(NewStore())
+	if form.Valid() {
+		t.Fatal("Expected an empty form to be invalid")
+	}
+	if form.Errors()["Path"] == "" || form.Errors()["Target"] == "" {
+		t.Errorf("Expected both Path and Target errors, got %v", form.Errors())
+	}
+
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	res, err := http.PostForm(server.URL+"/register", url.Values{"path": {""}, "target": {""}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	for _, message := range []string{"Path is required", "The target url is required"} {
+		if !strings.Contains(string(content), message) {
+			t.Errorf("Expected %q on the rendered form", message)
 		}
-		content, err := ioutil.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestResolveAndDirect(t *testing.T) {
+	app := Subject()
+	app.Register("https://backend.example:8443", "testing")
+
+	req := httptest.NewRequest("GET", "/proxy/testing/one/two?foo=bar", nil)
+	proxy, err := app.ResolveAndDirect(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy.Path != "testing" {
+		t.Errorf("Expected proxy testing, got %s", proxy.Path)
+	}
+	if got := req.URL.String(); got != "https://backend.example:8443/one/two?foo=bar" {
+		t.Errorf("Expected the request to be directed upstream, got %s", got)
+	}
+	if _, err := app.ResolveAndDirect(httptest.NewRequest("GET", "/proxy/missing/", nil)); err == nil {
+		t.Error("Expected an error for an unknown proxy")
+	}
+}
+
+func BenchmarkResolveAndDirect(b *testing.B) {
+	app := Subject()
+	const proxies = 1000
+	for i := 0; i < proxies; i++ {
+		app.Register(fmt.Sprintf("http://backend-%d.local:8080", i), fmt.Sprintf("proxy-%d", i))
+	}
+	paths := make([]string, proxies)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/proxy/proxy-%d/some/path?q=1", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("GET", paths[i%proxies], nil)
+		if _, err := app.ResolveAndDirect(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRegisterValidatesTarget(t *testing.T) {
+	invalid := map[string]string{
+		"not a url":   "has no scheme",
+		"example.com": "has no scheme",
+		"ftp://x":     "unsupported scheme ftp",
+		"http://":     "has no host",
+	}
+	for target, message := range invalid {
+		form := NewRegisterForm(NewStore())
+		form.values["Path"] = "p"
+		form.values["Target"] = target
+		if form.Valid() || !strings.Contains(form.Errors()["Target"], message) {
+			t.Errorf("Expected %q to fail with %q, got %v", target, message, form.Errors())
 		}
-		if string(content) != expected {
-			t.Errorf("Expected %s, got %s", expected, string(content))
+		if err := NewStore().Register(target, "p"); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected Register(%q) to fail with %q, got %v", target, message, err)
 		}
 	}
-	for path, expected := range postData {
 
-		res, err := http.Post(proxy.URL+path, "", nil)
-		if err != nil {
-			t.Errorf("Unexpected error %s", err)
+	store := NewStore()
+	if err := store.Register("http://localhost:9000", "local"); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if err := store.RegisterWithOptions("http://localhost:9000", "canary", ProxyOptions{CanaryTarget: "localhost:9001"}); err == nil {
+		t.Error("Expected an invalid canary target to be rejected")
+	}
+}
+
+func TestRegisterValidatesPath(t *testing.T) {
+	invalid := map[string]string{
+		"foo/bar": "single segment",
+		"":        "Path is required",
+		"a b":     "whitespace",
+		"a?b":     "single segment",
+	}
+	for path, message := range invalid {
+		form := NewRegisterForm(NewStore())
+		form.values["Path"] = path
+		form.values["Target"] = "http://localhost:9000"
+		if form.Valid() || !strings.Contains(form.Errors()["Path"], message) {
+			t.Errorf("Expected %q to fail with %q, got %v", path, message, form.Errors())
 		}
-		content, err := ioutil.ReadAll(res.Body)
-		res.Body.Close()
+		if err := NewStore().Register("http://localhost:9000", path); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected Register to reject %q with %q, got %v", path, message, err)
+		}
+	}
+
+	store := NewStore()
+	if err := store.Register("http://localhost:9000", "/foo"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if _, err := store.Find("foo"); err != nil {
+		t.Errorf("Expected /foo to be registered as foo")
+	}
+
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	res, err := http.PostForm(server.URL+"/register", url.Values{"path": {"/foo"}, "target": {"http://localhost:9000"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if _, err := app.Find("foo"); err != nil {
+		t.Errorf("Expected the form to register /foo as foo")
+	}
+}
+
+func TestRegisterRejectsDuplicatePath(t *testing.T) {
+	store := NewStore()
+	store.Register("http://localhost:9000", "foo")
+
+	err := store.Register("http://localhost:9001", "foo")
+	if !errors.Is(err, ErrAlreadyExists) || err.Error() != `path "foo" is already registered` {
+		t.Errorf("Expected an already registered error, got %v", err)
+	}
+	if proxy, _ := store.Find("foo"); proxy.URL.String() != "http://localhost:9000" {
+		t.Errorf("Expected the first proxy to be kept, got %s", proxy.URL)
+	}
+
+	if err := store.Update("http://localhost:9001", "foo"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy, _ := store.Find("foo"); proxy.URL.String() != "http://localhost:9001" {
+		t.Errorf("Expected Update to replace the target, got %s", proxy.URL)
+	}
+	if err := store.Update("http://localhost:9001", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound updating a missing path, got %v", err)
+	}
+
+	app := Subject()
+	app.Register("http://localhost:9000", "foo")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	res, err := http.PostForm(server.URL+"/register", url.Values{"path": {"foo"}, "target": {"http://localhost:9001"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(content), "is already registered") {
+		t.Errorf("Expected the form to re-render with the duplicate error, got %d %s", res.StatusCode, content)
+	}
+}
+
+func TestRegisterProxy(t *testing.T) {
+	app := Subject()
+	app.DefaultScheme = "http"
+	proxy, err := app.RegisterProxy("localhost:9000", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy.Path != "foo" || proxy.URL.String() != "http://localhost:9000" {
+		t.Errorf("Expected the normalized proxy at foo, got %s %s", proxy.Path, proxy.URL)
+	}
+	if _, err := app.RegisterProxy("http://localhost:9001", "foo"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Expected ErrAlreadyExists, got %v", err)
+	}
+}
+
+func TestStoreRename(t *testing.T) {
+	store := NewStore()
+	store.RegisterWithOptions("http://localhost:9000", "old", ProxyOptions{
+		ProxyDefaults: ProxyDefaults{Timeout: time.Second},
+		Retries:       2,
+	})
+	store.Register("http://localhost:9001", "taken")
+
+	if err := store.Rename("old", "taken"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Expected ErrAlreadyExists, got %v", err)
+	}
+	if err := store.Rename("missing", "new"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.Rename("old", "new"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if _, err := store.Find("old"); err == nil {
+		t.Error("Expected the old path to no longer resolve")
+	}
+	proxy, err := store.Find("new")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy.Path != "new" || proxy.URL.String() != "http://localhost:9000" {
+		t.Errorf("Expected new -> http://localhost:9000, got %s -> %s", proxy.Path, proxy.URL)
+	}
+	if proxy.Timeout != time.Second || proxy.Retries != 2 {
+		t.Errorf("Expected options to survive the rename, got %+v", proxy.ProxyOptions)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer backend.Close()
+
+	templates := template.Must(LoadTemplates(""))
+	app := NewApp(templates, NewStore())
+	app.BasePath = NormalizeBasePath("reverser/")
+	app.Setup()
+	app.Register(backend.URL, "testing")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	content := get(t, server.URL+"/reverser/")
+	for _, link := range []string{`href="/reverser/register"`, `href="/reverser/proxy/testing"`, `href="/reverser/assets/css/bootstrap.css"`} {
+		if !strings.Contains(content, link) {
+			t.Errorf("Expected %s in the index page", link)
+		}
+	}
+	if content := get(t, server.URL+"/reverser/proxy/testing/one"); content != "/one" {
+		t.Errorf("Expected the proxy to strip the base path, got %s", content)
+	}
+	if res := fetch(t, server.URL+"/register"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected routes outside the base path to 404, got %d", res.StatusCode)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.PostForm(server.URL+"/reverser/register", url.Values{"path": {"new"}, "target": {backend.URL}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if location := res.Header.Get("Location"); location != "/reverser/" {
+		t.Errorf("Expected a redirect to /reverser/, got %s", location)
+	}
+}
+
+func TestProxyToHTTPSBackend(t *testing.T) {
+	var host string
+	var overTLS bool
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		overTLS = r.TLS != nil
+		w.Write([]byte("secure"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Transport = backend.Client().Transport
+	app.Register(backend.URL, "secure")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if content := get(t, server.URL+"/proxy/secure/"); content != "secure" {
+		t.Errorf("Expected the HTTPS backend to respond, got %s", content)
+	}
+	if !overTLS {
+		t.Error("Expected the upstream request to use TLS")
+	}
+	if host != strings.TrimPrefix(backend.URL, "https://") {
+		t.Errorf("Expected Host %s, got %s", strings.TrimPrefix(backend.URL, "https://"), host)
+	}
+}
+
+func TestDefaultPortLeftOutOfHost(t *testing.T) {
+	app := Subject()
+	app.Register("https://backend.example:443", "explicit")
+	app.Register("http://backend.example:8080", "custom")
+
+	req := httptest.NewRequest("GET", "/proxy/explicit/", nil)
+	app.ResolveAndDirect(req)
+	if req.Host != "backend.example" || req.URL.Host != "backend.example:443" {
+		t.Errorf("Expected Host backend.example dialing backend.example:443, got %s dialing %s", req.Host, req.URL.Host)
+	}
+	req = httptest.NewRequest("GET", "/proxy/custom/", nil)
+	app.ResolveAndDirect(req)
+	if req.Host != "backend.example:8080" {
+		t.Errorf("Expected Host backend.example:8080, got %s", req.Host)
+	}
+}
+
+func TestClientDisconnectCancelsUpstream(t *testing.T) {
+	received := make(chan struct{})
+	cancelled := make(chan struct{})
+	h := NewTestHarness(t, map[string]http.Handler{
+		"slow": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(5 * time.Second):
+			}
+		}),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", h.URL("/proxy/slow/"), nil)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := h.Client.Do(req.WithContext(ctx))
+		errs <- err
+	}()
+
+	<-received
+	cancel()
+	if err := <-errs; err == nil {
+		t.Error("Expected the cancelled client request to fail")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the upstream request to be cancelled when the client went away")
+	}
+}
+
+func TestLowercasePath(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "lower", ProxyOptions{LowercasePath: true})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if content := get(t, server.URL+"/proxy/lower/Some/MixedCase%20Path?Key=Value"); content != "/some/mixedcase%20path?Key=Value" {
+		t.Errorf("Expected a lowercased path with the query untouched, got %s", content)
+	}
+}
+
+func TestResolveListenAddr(t *testing.T) {
+	cases := []struct {
+		addr    string
+		addrSet bool
+		port    string
+		want    string
+	}{
+		{DefaultAddr, false, "", ":8000"},
+		{DefaultAddr, false, "5000", ":5000"},
+		{"127.0.0.1:9000", true, "5000", "127.0.0.1:9000"},
+	}
+	for _, c := range cases {
+		if got := resolveListenAddr(c.addr, c.addrSet, c.port); got != c.want {
+			t.Errorf("Expected %s for %+v, got %s", c.want, c, got)
+		}
+	}
+}
+
+func TestEditProxy(t *testing.T) {
+	app := Subject()
+	app.RegisterWithOptions("http://localhost:9000", "foo", ProxyOptions{ProxyDefaults: ProxyDefaults{Headers: map[string]string{"X-Env": "test"}}})
+	before, _ := app.Find("foo")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if page := get(t, server.URL+"/edit?path=foo"); !strings.Contains(page, `value="http://localhost:9000"`) {
+		t.Errorf("Expected the form to be filled in with the current target, got %s", page)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.PostForm(server.URL+"/edit?path=foo", url.Values{"target": {"not a url"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected an invalid target to show the form again, got %d", res.StatusCode)
+	}
+
+	res, err = client.PostForm(server.URL+"/edit?path=foo", url.Values{"target": {"http://localhost:9001"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Errorf("Expected a redirect after saving, got %d", res.StatusCode)
+	}
+	proxy, err := app.Find("foo")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if proxy.URL.String() != "http://localhost:9001" {
+		t.Errorf("Expected the target to be updated, got %s", proxy.URL)
+	}
+	if proxy.Headers["X-Env"] != "test" || proxy.Stats != before.Stats {
+		t.Error("Expected the proxy's options and counters to be kept")
+	}
+
+	res, err = http.Get(server.URL + "/edit?path=missing")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing proxy, got %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestProxyWithoutID(t *testing.T) {
+	var logged syncBuffer
+	app := Subject()
+	app.Logger = log.New(&logged, "", 0)
+	app.Register("http://localhost:9000", "foo")
+	server := httptest.NewUnstartedServer(app.Router)
+	server.Config.ErrorLog = log.New(&logged, "", 0)
+	server.Start()
+	defer server.Close()
+
+	for _, path := range []string{"/proxy/", "/proxy"} {
+		res, err := http.Get(server.URL + path)
 		if err != nil {
-			t.Errorf("Unexpected error %s", err)
+			t.Fatalf("Unexpected error for %s: %s", path, err)
 		}
-		if string(content) != expected {
-			t.Errorf("Expected %s, got %s", expected, string(content))
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusNotFound, path, res.StatusCode)
 		}
 	}
+	if strings.Contains(logged.String(), "panic") {
+		t.Errorf("Expected no panic, got %s", logged.String())
+	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// SetMaintenance pauses or resumes proxying for every proxy. Admin routes
+// keep working while paused.
+func (app *App) SetMaintenance(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&app.maintenance, value)
+}
+
+func (app *App) Maintenance() bool {
+	return atomic.LoadInt32(&app.maintenance) == 1
+}
+
+func (app *App) renderMaintenance(w http.ResponseWriter) {
+	viewContext := NewViewContext()
+	viewContext["Title"] = "reverser-maintenance"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", "60")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	app.ExecuteTemplate(w, "maintenance.html", viewContext)
+}
+
+type maintenanceRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (app *App) MountMaintenanceHandlers() {
+	app.HandleAPI("/api/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]bool{"maintenance": app.Maintenance()})
+	}).Methods("GET")
+	app.HandleAPI("/api/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		var req maintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		app.SetMaintenance(req.Enabled)
+		writeJSON(w, http.StatusOK, map[string]bool{"maintenance": app.Maintenance()})
+	}).Methods("POST")
+}
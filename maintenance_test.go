@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setMaintenance(t *testing.T, url string, body string) {
+	res, err := http.Post(url+"/api/maintenance", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestMaintenanceToggle(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "one")
+	app.Register(backend.URL, "two")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	setMaintenance(t, server.URL, `{"enabled":true}`)
+	for _, path := range []string{"/proxy/one/", "/proxy/two/x"} {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusServiceUnavailable, path, res.StatusCode)
+		}
+	}
+	if content := get(t, server.URL+"/"); !strings.Contains(content, "ProxyList") {
+		t.Error("Expected the admin UI to stay up during maintenance")
+	}
+
+	setMaintenance(t, server.URL, `{"enabled":false}`)
+	if content := get(t, server.URL+"/proxy/one/"); content != "backend" {
+		t.Errorf("Expected normal proxying after maintenance, got %s", content)
+	}
+}
+
+func TestMaintenanceToggleRequiresJSON(t *testing.T) {
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/api/maintenance", "text/plain", strings.NewReader(`{"enabled":true}`))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status %d for a text/plain toggle, got %d", http.StatusUnsupportedMediaType, res.StatusCode)
+	}
+	if app.Maintenance() {
+		t.Error("Expected a cross-site toggle not to pause proxying")
+	}
+}
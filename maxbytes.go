@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxBytesBody fails reads once more than limit bytes have been read, which
+// makes the reverse proxy abort the client connection mid-stream.
+type maxBytesBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+func (b *maxBytesBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, fmt.Errorf("response body exceeds %d bytes", b.limit)
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// limitResponse enforces MaxResponseBytes. A declared Content-Length over the
+// limit is rejected before anything is sent; otherwise the body is counted
+// as it streams.
+func (p *Proxy) limitResponse(res *http.Response) error {
+	if p.MaxResponseBytes <= 0 {
+		return nil
+	}
+	if res.ContentLength > p.MaxResponseBytes {
+		res.Body.Close()
+		return fmt.Errorf("response body of %d bytes exceeds %d bytes", res.ContentLength, p.MaxResponseBytes)
+	}
+	res.Body = &maxBytesBody{ReadCloser: res.Body, limit: p.MaxResponseBytes, remaining: p.MaxResponseBytes}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type syncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	large := strings.Repeat("x", 1000)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/streamed" {
+			w.Write([]byte(large[:500]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(large[500:]))
+			return
+		}
+		w.Write([]byte(large))
+	}))
+	defer backend.Close()
+
+	var logged syncBuffer
+	app := Subject()
+	app.Logger = log.New(&logged, "", 0)
+	app.RegisterWithOptions(backend.URL, "capped", ProxyOptions{MaxResponseBytes: 100})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/proxy/capped/streamed")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err == nil {
+		t.Error("Expected the response to be cut off")
+	}
+	if len(body) > 100 {
+		t.Errorf("Expected at most 100 bytes, got %d", len(body))
+	}
+	if !strings.Contains(logged.String(), "exceeds 100 bytes") {
+		t.Errorf("Expected the cut off to be logged, got %q", logged.String())
+	}
+
+	if res := fetch(t, server.URL+"/proxy/capped/sized"); res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status %d for a declared oversize body, got %d", http.StatusBadGateway, res.StatusCode)
+	}
+}
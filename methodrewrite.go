@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func (p *Proxy) rewriteMethod(req *http.Request) {
+	if method, ok := p.MethodRewrite[req.Method]; ok {
+		req.Method = method
+	}
+}
+
+// withInboundMethod remembers the client's method on the request context, so
+// the response can still be treated as a reply to it after a rewrite.
+func withInboundMethod(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), inboundMethodKey, r.Method))
+}
+
+// stripRewrittenHead drops the body of a response to a HEAD request that was
+// sent upstream as something else. Headers, including Content-Length, are
+// kept as a HEAD response would have them.
+func stripRewrittenHead(res *http.Response) {
+	inbound, _ := res.Request.Context().Value(inboundMethodKey).(string)
+	if inbound != "HEAD" || res.Request.Method == "HEAD" {
+		return
+	}
+	res.Body.Close()
+	res.Body = http.NoBody
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMethodRewrite(t *testing.T) {
+	var method string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.Write([]byte("full body"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "quirky", ProxyOptions{MethodRewrite: map[string]string{"HEAD": "GET", "PATCH": "POST"}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Head(server.URL + "/proxy/quirky/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if method != "GET" {
+		t.Errorf("Expected the backend to receive GET, got %s", method)
+	}
+	if res.StatusCode != http.StatusOK || len(body) != 0 {
+		t.Errorf("Expected 200 without a body, got %d %q", res.StatusCode, body)
+	}
+
+	req, _ := http.NewRequest("PATCH", server.URL+"/proxy/quirky/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusOK || method != "POST" {
+		t.Errorf("Expected PATCH to reach the backend as POST, got %s", method)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sortedProxies returns the registered proxies ordered by path, so metric
+// output is stable between scrapes.
+func (app *App) sortedProxies() []*Proxy {
+	list := app.ProxyList()
+	proxies := make([]*Proxy, 0, len(list))
+	for _, proxy := range list {
+		proxies = append(proxies, proxy)
+	}
+	sort.Slice(proxies, func(i, j int) bool { return proxies[i].Path < proxies[j].Path })
+	return proxies
+}
+
+// DefaultMetricsNamespace prefixes every exported metric unless
+// App.MetricsNamespace says otherwise.
+const DefaultMetricsNamespace = "reverser"
+
+// metricName joins the app's metrics namespace and subsystem to name, as
+// Prometheus client libraries do, skipping empty parts.
+func (app *App) metricName(name string) string {
+	var parts []string
+	for _, part := range []string{app.MetricsNamespace, app.MetricsSubsystem, name} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// ServeMetrics writes per-proxy metrics in the Prometheus text format.
+func (app *App) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	inFlight := app.metricName("in_flight_requests")
+	fmt.Fprintf(w, "# HELP %s Requests currently being proxied.\n", inFlight)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", inFlight)
+	proxies := app.sortedProxies()
+	for _, proxy := range proxies {
+		fmt.Fprintf(w, "%s{proxy=\"%s\"} %d\n", inFlight, labelEscaper.Replace(proxy.Path), proxy.Stats.InFlight())
+	}
+	duration := app.metricName("request_duration_seconds")
+	fmt.Fprintf(w, "# HELP %s Proxied request latency.\n", duration)
+	fmt.Fprintf(w, "# TYPE %s summary\n", duration)
+	for _, proxy := range proxies {
+		label := labelEscaper.Replace(proxy.Path)
+		latency := &proxy.Stats.Latency
+		for _, q := range []float64{0.5, 0.95, 0.99} {
+			fmt.Fprintf(w, "%s{proxy=\"%s\",quantile=\"%v\"} %v\n", duration, label, q, latency.Quantile(q).Seconds())
+		}
+		fmt.Fprintf(w, "%s_sum{proxy=\"%s\"} %v\n", duration, label, latency.Sum().Seconds())
+		fmt.Fprintf(w, "%s_count{proxy=\"%s\"} %d\n", duration, label, latency.Count())
+	}
+	requests := app.metricName("requests_total")
+	fmt.Fprintf(w, "# HELP %s Responses sent for each proxy, by status code.\n", requests)
+	fmt.Fprintf(w, "# TYPE %s counter\n", requests)
+	for _, proxy := range proxies {
+		statuses := proxy.Stats.Statuses()
+		codes := make([]int, 0, len(statuses))
+		for code := range statuses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "%s{proxy=\"%s\",code=\"%d\"} %d\n", requests, labelEscaper.Replace(proxy.Path), code, statuses[code])
+		}
+	}
+	upstream := app.metricName("upstream_duration_seconds")
+	fmt.Fprintf(w, "# HELP %s Time taken by requests forwarded upstream.\n", upstream)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", upstream)
+	for _, proxy := range proxies {
+		label := labelEscaper.Replace(proxy.Path)
+		cumulative, count, sum := proxy.Stats.Duration.Cumulative()
+		for i, bound := range DefaultHistogramBuckets {
+			fmt.Fprintf(w, "%s_bucket{proxy=\"%s\",le=\"%v\"} %d\n", upstream, label, bound, cumulative[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{proxy=\"%s\",le=\"+Inf\"} %d\n", upstream, label, count)
+		fmt.Fprintf(w, "%s_sum{proxy=\"%s\"} %v\n", upstream, label, sum.Seconds())
+		fmt.Fprintf(w, "%s_count{proxy=\"%s\"} %d\n", upstream, label, count)
+	}
+	limit := app.metricName("concurrency_limit")
+	fmt.Fprintf(w, "# HELP %s Adaptive concurrency limit of proxies that enable it.\n", limit)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", limit)
+	for _, proxy := range proxies {
+		if proxy.Limiter != nil {
+			fmt.Fprintf(w, "%s{proxy=\"%s\"} %d\n", limit, labelEscaper.Replace(proxy.Path), proxy.Limiter.Limit())
+		}
+	}
+	shed := app.metricName("shed_requests_total")
+	fmt.Fprintf(w, "# HELP %s Requests rejected by the adaptive concurrency limit.\n", shed)
+	fmt.Fprintf(w, "# TYPE %s counter\n", shed)
+	for _, proxy := range proxies {
+		if proxy.Limiter != nil {
+			fmt.Fprintf(w, "%s{proxy=\"%s\"} %d\n", shed, labelEscaper.Replace(proxy.Path), proxy.Limiter.Shed())
+		}
+	}
+}
+
+func (app *App) MountMetricsHandler() {
+	app.Router.HandleFunc(app.Link("/metrics"), app.ServeMetrics).Methods("GET")
+}
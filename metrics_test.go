@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func proxyDetail(t *testing.T, url string) ProxyDetail {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	var detail ProxyDetail
+	if err := json.NewDecoder(res.Body).Decode(&detail); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return detail
+}
+
+func TestInFlightGauge(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "slow")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			if res, err := http.Get(server.URL + "/proxy/slow/"); err == nil {
+				res.Body.Close()
+			}
+			done <- struct{}{}
+		}()
+	}
+
+	proxy, _ := app.Find("slow")
+	deadline := time.Now().Add(5 * time.Second)
+	for proxy.Stats.InFlight() != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if metrics := get(t, server.URL+"/metrics"); !strings.Contains(metrics, `reverser_in_flight_requests{proxy="slow"} 3`) {
+		t.Errorf("Expected the gauge at 3, got %s", metrics)
+	}
+	if detail := proxyDetail(t, server.URL+"/api/proxies/slow"); detail.InFlight != 3 {
+		t.Errorf("Expected 3 in flight in the detail API, got %d", detail.InFlight)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	if proxy.Stats.InFlight() != 0 {
+		t.Errorf("Expected the gauge back at 0, got %d", proxy.Stats.InFlight())
+	}
+}
+
+func TestLatencyPercentilesExposed(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "timed")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	get(t, server.URL+"/proxy/timed/")
+
+	if detail := proxyDetail(t, server.URL+"/api/proxies/timed"); detail.P50MS <= 0 || detail.P99MS < detail.P50MS {
+		t.Errorf("Expected percentiles in the detail API, got p50 %f p99 %f", detail.P50MS, detail.P99MS)
+	}
+	metrics := get(t, server.URL+"/metrics")
+	for _, line := range []string{`reverser_request_duration_seconds{proxy="timed",quantile="0.99"}`, `reverser_request_duration_seconds_count{proxy="timed"} 1`} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("Expected %s in metrics, got %s", line, metrics)
+		}
+	}
+}
+
+func TestMetricsNamespace(t *testing.T) {
+	app := Subject()
+	app.MetricsNamespace = "edge"
+	app.MetricsSubsystem = "proxy"
+	app.RegisterWithOptions("http://localhost:9000", "api", ProxyOptions{AdaptiveConcurrency: true})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	metrics := get(t, server.URL+"/metrics")
+	for _, line := range strings.Split(strings.TrimSpace(metrics), "\n") {
+		name := strings.TrimPrefix(strings.TrimPrefix(line, "# HELP "), "# TYPE ")
+		if !strings.HasPrefix(name, "edge_proxy_") {
+			t.Errorf("Expected every metric to be prefixed with edge_proxy_, got %s", line)
+		}
+	}
+	if !strings.Contains(metrics, `edge_proxy_in_flight_requests{proxy="api"} 0`) {
+		t.Errorf("Expected the in-flight gauge under the namespace, got %s", metrics)
+	}
+}
+
+func TestRequestCountersAndHistogram(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "api")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	get(t, server.URL+"/proxy/api/")
+	get(t, server.URL+"/proxy/api/")
+	get(t, server.URL+"/proxy/api/missing")
+	get(t, server.URL+"/proxy/unknown/")
+
+	metrics := get(t, server.URL+"/metrics")
+	for _, line := range []string{
+		`reverser_requests_total{proxy="api",code="200"} 2`,
+		`reverser_requests_total{proxy="api",code="404"} 1`,
+		`reverser_upstream_duration_seconds_bucket{proxy="api",le="+Inf"} 3`,
+		`reverser_upstream_duration_seconds_count{proxy="api"} 3`,
+		"# TYPE reverser_upstream_duration_seconds histogram",
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("Expected %s in metrics, got %s", line, metrics)
+		}
+	}
+	if strings.Contains(metrics, "unknown") {
+		t.Errorf("Expected unregistered ids to be left out of metrics, got %s", metrics)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+const DefaultProxyPrefix = "/proxy/"
+
+// Option configures an App in NewApp.
+type Option func(*App)
+
+// WithProxyPrefix mounts proxies under prefix instead of /proxy/.
+func WithProxyPrefix(prefix string) Option {
+	return func(app *App) {
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" {
+			app.ProxyPrefix = "/"
+			return
+		}
+		app.ProxyPrefix = "/" + prefix + "/"
+	}
+}
+
+// WithRequestTimeout bounds upstream requests for proxies without their own
+// timeout.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(app *App) {
+		app.RequestTimeout = timeout
+	}
+}
+
+// WithAuthenticator protects the admin routes with authenticator.
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(app *App) {
+		app.Authenticator = authenticator
+	}
+}
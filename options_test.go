@@ -0,0 +1,66 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAppDefaults(t *testing.T) {
+	app := NewApp(template.Must(LoadTemplates("")), NewStore())
+	if app.ProxyPrefix != DefaultProxyPrefix {
+		t.Errorf("Expected prefix %s, got %s", DefaultProxyPrefix, app.ProxyPrefix)
+	}
+	if app.RequestTimeout != 0 {
+		t.Errorf("Expected no request timeout, got %s", app.RequestTimeout)
+	}
+	if app.Authenticator != nil {
+		t.Errorf("Expected no authenticator, got %v", app.Authenticator)
+	}
+}
+
+func TestNewAppOptions(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer backend.Close()
+
+	app := NewApp(template.Must(LoadTemplates("")), NewStore(),
+		WithProxyPrefix("routes"),
+		WithRequestTimeout(50*time.Millisecond),
+		WithAuthenticator(tokenAuth("secret")),
+	)
+	app.Setup()
+	app.Register(backend.URL, "testing")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if content := get(t, server.URL+"/routes/testing/fast"); content != "/fast" {
+		t.Errorf("Expected proxying under /routes/, got %s", content)
+	}
+	if res := fetch(t, server.URL+"/routes/testing/slow"); res.StatusCode == http.StatusOK {
+		t.Error("Expected the request timeout to cut off the slow backend")
+	}
+	if res := fetch(t, server.URL+"/"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the authenticator to guard the UI, got %d", res.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(content), `href="/routes/testing"`) {
+		t.Errorf("Expected links to use the proxy prefix, got %s", content)
+	}
+}
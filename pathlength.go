@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+// DefaultMaxPathLength matches the request line limits common to browsers
+// and load balancers.
+const DefaultMaxPathLength = 2048
+
+// pathLengthChecker is implemented by stores that cap path length, such as
+// App, so forms can report an over-long path against the path field.
+type pathLengthChecker interface {
+	checkPathLength(path string) error
+}
+
+func (app *App) checkPathLength(path string) error {
+	if app.MaxPathLength > 0 && len(path) > app.MaxPathLength {
+		return fmt.Errorf("path is %d characters long, longer than the %d allowed", len(path), app.MaxPathLength)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxPathLength(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	app := Subject()
+	app.MaxPathLength = 64
+	if err := app.Register(backend.URL, strings.Repeat("a", 65)); err == nil {
+		t.Error("Expected an over-long path to be rejected")
+	}
+	if err := app.Register(backend.URL, "short"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := app.Rename("short", strings.Repeat("b", 65)); err == nil {
+		t.Error("Expected renaming to an over-long path to be rejected")
+	}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/short/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	req, _ = http.NewRequest("GET", server.URL+"/proxy/short/"+strings.Repeat("x", 64), nil)
+	if res := status(t, req); res.StatusCode != http.StatusRequestURITooLong {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestURITooLong, res.StatusCode)
+	}
+}
+
+func TestRegisterFormPathTooLong(t *testing.T) {
+	app := Subject()
+	app.MaxPathLength = 8
+	form := NewRegisterForm(app)
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("path=much-too-long&target=http://example.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if form.Submit(req) {
+		t.Fatal("Expected an over-long path to be rejected")
+	}
+	if form.Errors()["Path"] == "" || form.Errors()["Target"] != "" {
+		t.Errorf("Expected the error against the path, got %v", form.Errors())
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NormalizePath drops the leading slash users tend to type, so /foo is
+// registered as foo.
+func NormalizePath(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// ValidatePath checks that path is a single segment MountProxyHandler can
+// route to: /proxy/foo/bar is always proxy foo with path /bar.
+func ValidatePath(path string) error {
+	if path == "" {
+		return errors.New("Path is required")
+	}
+	if strings.ContainsAny(path, "/?") {
+		return fmt.Errorf("path %q must be a single segment without / or ?", path)
+	}
+	if strings.IndexFunc(path, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("path %q must not contain whitespace", path)
+	}
+	return nil
+}
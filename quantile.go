@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	quantileMin     = 100 * time.Microsecond
+	quantileGrowth  = 1.05
+	quantileBuckets = 360 // covers up to about an hour
+)
+
+// QuantileTracker estimates latency quantiles from a stream of observations
+// using exponentially sized buckets, each 5% wider than the last. Memory is
+// fixed and estimates are within about 2.5% of the true value.
+type QuantileTracker struct {
+	sync.Mutex
+	counts []int64
+	count  int64
+	sum    time.Duration
+}
+
+func quantileBucket(d time.Duration) int {
+	if d <= quantileMin {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(quantileMin)) / math.Log(quantileGrowth)))
+	if i >= quantileBuckets {
+		return quantileBuckets - 1
+	}
+	return i
+}
+
+func (q *QuantileTracker) Observe(d time.Duration) {
+	q.Lock()
+	defer q.Unlock()
+	if q.counts == nil {
+		q.counts = make([]int64, quantileBuckets)
+	}
+	q.counts[quantileBucket(d)]++
+	q.count++
+	q.sum += d
+}
+
+// Quantile returns the estimated p quantile (0 < p <= 1), or 0 before any
+// observations.
+func (q *QuantileTracker) Quantile(p float64) time.Duration {
+	q.Lock()
+	defer q.Unlock()
+	if q.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p * float64(q.count)))
+	var seen int64
+	for i, n := range q.counts {
+		seen += n
+		if seen >= rank {
+			if i == 0 {
+				return quantileMin
+			}
+			// Geometric midpoint of (min*g^(i-1), min*g^i].
+			return time.Duration(float64(quantileMin) * math.Pow(quantileGrowth, float64(i)-0.5))
+		}
+	}
+	return 0
+}
+
+// Count and Sum are the number and total of all observations.
+func (q *QuantileTracker) Count() int64 {
+	q.Lock()
+	defer q.Unlock()
+	return q.count
+}
+
+func (q *QuantileTracker) Sum() time.Duration {
+	q.Lock()
+	defer q.Unlock()
+	return q.sum
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestQuantileTracker(t *testing.T) {
+	q := &QuantileTracker{}
+	if q.Quantile(0.5) != 0 {
+		t.Error("Expected no estimate before any observations")
+	}
+
+	// A shuffled uniform distribution of 1ms..1000ms.
+	for _, i := range rand.Perm(1000) {
+		q.Observe(time.Duration(i+1) * time.Millisecond)
+	}
+
+	expected := map[float64]time.Duration{
+		0.5:  500 * time.Millisecond,
+		0.95: 950 * time.Millisecond,
+		0.99: 990 * time.Millisecond,
+	}
+	for p, want := range expected {
+		got := q.Quantile(p)
+		if math.Abs(float64(got-want))/float64(want) > 0.05 {
+			t.Errorf("Expected p%v near %s, got %s", p*100, want, got)
+		}
+	}
+	if q.Count() != 1000 {
+		t.Errorf("Expected 1000 observations, got %d", q.Count())
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// moveQueryToHeaders moves the query parameters named in QueryToHeader into
+// their request headers, removing them from the forwarded query. The other
+// parameters keep their order and encoding.
+func (p *Proxy) moveQueryToHeaders(req *http.Request) {
+	if len(p.QueryToHeader) == 0 || req.URL.RawQuery == "" {
+		return
+	}
+	var kept []string
+	for _, pair := range strings.Split(req.URL.RawQuery, "&") {
+		rawName := pair
+		rawValue := ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			rawName, rawValue = pair[:i], pair[i+1:]
+		}
+		name, err := url.QueryUnescape(rawName)
+		header, ok := p.QueryToHeader[name]
+		if err != nil || !ok {
+			kept = append(kept, pair)
+			continue
+		}
+		if value, err := url.QueryUnescape(rawValue); err == nil {
+			req.Header.Set(header, value)
+		}
+	}
+	req.URL.RawQuery = strings.Join(kept, "&")
+}
+
+// queryHeaders lists the headers QueryToHeader sets, in a stable order.
+func (p *Proxy) queryHeaders() []string {
+	var headers []string
+	for _, header := range p.QueryToHeader {
+		headers = append(headers, header)
+	}
+	sort.Strings(headers)
+	return headers
+}
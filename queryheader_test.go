@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueryToHeader(t *testing.T) {
+	type upstream struct {
+		query string
+		key   string
+	}
+	received := make(chan upstream, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- upstream{r.URL.RawQuery, r.Header.Get("X-API-Key")}
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "keyed", ProxyOptions{QueryToHeader: map[string]string{"api_key": "X-API-Key"}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	fetch(t, server.URL+"/proxy/keyed/items?b=2&api_key=s%2Fcret&a=1")
+	got := <-received
+	if got.query != "b=2&a=1" {
+		t.Errorf("Expected the api_key parameter to be removed, got %q", got.query)
+	}
+	if got.key != "s/cret" {
+		t.Errorf("Expected X-API-Key to be set from the query, got %q", got.key)
+	}
+
+	fetch(t, server.URL+"/proxy/keyed/items?a=1")
+	if got := <-received; got.query != "a=1" || got.key != "" {
+		t.Errorf("Expected requests without the parameter to pass through, got %+v", got)
+	}
+}
+
+func TestQueryToHeaderCachedPerKey(t *testing.T) {
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Write([]byte(r.Header.Get("X-API-Key")))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "keyed", ProxyOptions{QueryToHeader: map[string]string{"api_key": "X-API-Key"}, CacheTTL: time.Minute})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if body := get(t, server.URL+"/proxy/keyed/items?api_key=alice"); body != "alice" {
+		t.Errorf("Expected alice's response, got %q", body)
+	}
+	if body := get(t, server.URL+"/proxy/keyed/items?api_key=bob"); body != "bob" {
+		t.Errorf("Expected bob's own response, got %q", body)
+	}
+	if hits != 2 {
+		t.Errorf("Expected each key to reach the upstream, got %d hits", hits)
+	}
+}
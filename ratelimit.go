@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultMutationBurst = 5
+
+// RateLimiter is a token bucket allowing Rate events per second on average
+// and up to Burst at once.
+type RateLimiter struct {
+	sync.Mutex
+	Rate  float64
+	Burst int
+
+	now    func() time.Time
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{Rate: rate, Burst: burst, now: time.Now, tokens: float64(burst)}
+}
+
+// Allow reports whether an event fits in the limit, spending a token if so.
+func (l *RateLimiter) Allow() bool {
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.Rate
+		if l.tokens > float64(l.Burst) {
+			l.tokens = float64(l.Burst)
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// throttleMutations limits admin requests that change state, anything but
+// GET and HEAD, to app.MutationLimiter. Requests over the limit get a 429.
+// Reads are never limited.
+func (app *App) throttleMutations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.MutationLimiter == nil || r.Method == "GET" || r.Method == "HEAD" || app.MutationLimiter.Allow() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", "1")
+		if wantsJSON(r) {
+			writeJSONError(w, http.StatusTooManyRequests, "too many changes, try again shortly")
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(2, 2)
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.Allow() || !limiter.Allow() {
+		t.Error("Expected the burst to be allowed")
+	}
+	if limiter.Allow() {
+		t.Error("Expected the limit to be reached after the burst")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !limiter.Allow() {
+		t.Error("Expected a token to be refilled after half a second")
+	}
+}
+
+func TestMutationRateLimit(t *testing.T) {
+	app := Subject()
+	app.MutationLimiter = NewRateLimiter(1, 3)
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	throttled := 0
+	for i := 0; i < 10; i++ {
+		body := fmt.Sprintf(`{"path": "p%d", "target": "http://localhost:9000"}`, i)
+		req, _ := http.NewRequest("POST", server.URL+"/api/proxies", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		res := status(t, req)
+		if res.StatusCode == http.StatusTooManyRequests {
+			throttled++
+			if res.Header.Get("Retry-After") == "" {
+				t.Error("Expected a Retry-After header on 429")
+			}
+		}
+	}
+	if throttled == 0 || throttled > 7 {
+		t.Errorf("Expected rapid registrations past the burst to be throttled, got %d of 10", throttled)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/proxies", nil)
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected reads to be unaffected, got %d", res.StatusCode)
+	}
+}
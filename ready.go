@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// ReadinessPolicy sets how backend health feeds into /readyz.
+type ReadinessPolicy int
+
+const (
+	// ReadyAny is ready while any backend is healthy.
+	ReadyAny ReadinessPolicy = iota
+	// ReadyAll is ready only while every backend is healthy.
+	ReadyAll
+)
+
+// ParseReadinessPolicy parses "any" or "all".
+func ParseReadinessPolicy(name string) (ReadinessPolicy, error) {
+	switch name {
+	case "any":
+		return ReadyAny, nil
+	case "all":
+		return ReadyAll, nil
+	}
+	return ReadyAny, fmt.Errorf("unknown readiness policy %q", name)
+}
+
+// Ready reports whether startup configuration has finished loading. Until it
+// has, the proxy mount answers 503 rather than 404 for routes that are about
+// to exist.
+func (app *App) Ready() bool {
+	return atomic.LoadInt32(&app.loading) == 0
+}
+
+// Load runs load with proxying gated off until it returns. Admin routes are
+// unaffected.
+func (app *App) Load(load func() error) error {
+	atomic.AddInt32(&app.loading, 1)
+	defer atomic.AddInt32(&app.loading, -1)
+	return load()
+}
+
+// LoadInBackground gates proxying off before it returns and runs Load in a
+// goroutine, so the listener can start while startup configuration loads.
+// The result of load is sent on the returned channel.
+func (app *App) LoadInBackground(load func() error) <-chan error {
+	atomic.AddInt32(&app.loading, 1)
+	result := make(chan error, 1)
+	go func() {
+		err := app.Load(load)
+		atomic.AddInt32(&app.loading, -1)
+		result <- err
+	}()
+	return result
+}
+
+func renderNotReady(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "reverser is starting, try again shortly", http.StatusServiceUnavailable)
+}
+
+// backendsReady reports whether the health of the upstream backends allows
+// taking traffic under app.Readiness. Without any upstreams there is nothing
+// to wait for.
+func (app *App) backendsReady() bool {
+	total, healthy := 0, 0
+	for _, proxy := range app.ProxyList() {
+		if proxy.Static() {
+			continue
+		}
+		for _, backend := range proxy.Backends {
+			total++
+			if app.Health.Healthy(backend) {
+				healthy++
+			}
+		}
+	}
+	if total == 0 {
+		return true
+	}
+	if app.Readiness == ReadyAll {
+		return healthy == total
+	}
+	return healthy > 0
+}
+
+// Pinger is implemented by stores that can be unreachable, such as one
+// backed by a file.
+type Pinger interface {
+	Ping() error
+}
+
+// serverReady reports why reverser itself can't serve yet, or "" when it can:
+// the templates must be loaded and the store reachable.
+func (app *App) serverReady() string {
+	if app.Template == nil || app.Template.Lookup("index.html") == nil {
+		return "templates not loaded"
+	}
+	if pinger, ok := app.DataStore.(Pinger); ok {
+		if err := pinger.Ping(); err != nil {
+			return "store unreachable"
+		}
+	}
+	return ""
+}
+
+// MountReadinessHandler serves /healthz and /readyz for load balancers and
+// orchestrators. /healthz answers 200 whenever the process is serving.
+// /readyz answers 200 once startup has loaded, the templates and store are
+// usable and the backends are healthy enough, 503 otherwise. Both are left
+// unauthenticated so probes don't need credentials.
+func (app *App) MountReadinessHandler() {
+	app.Router.HandleFunc(app.Link("/healthz"), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	}).Methods("GET", "HEAD")
+	app.Router.HandleFunc(app.Link("/readyz"), func(w http.ResponseWriter, r *http.Request) {
+		if reason := app.serverReady(); reason != "" {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		switch {
+		case !app.Ready():
+			http.Error(w, "loading", http.StatusServiceUnavailable)
+		case !app.backendsReady():
+			http.Error(w, "backends unhealthy", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ready\n"))
+		}
+	}).Methods("GET", "HEAD")
+}
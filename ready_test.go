@@ -0,0 +1,151 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNotReadyDuringLoad(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("loaded"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loaded := make(chan error)
+	go func() {
+		loaded <- app.Load(func() error {
+			close(started)
+			<-release
+			return app.Register(backend.URL, "slow")
+		})
+	}()
+
+	<-started
+	res := fetch(t, server.URL+"/proxy/slow/")
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d while loading, got %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header while loading")
+	}
+
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if content := get(t, server.URL+"/proxy/slow/"); content != "loaded" {
+		t.Errorf("Expected proxying once loaded, got %s", content)
+	}
+}
+
+func TestReadinessFollowsHealth(t *testing.T) {
+	var failing int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer flaky.Close()
+	steady := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer steady.Close()
+
+	app := Subject()
+	app.Register(flaky.URL, "flaky")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	readyz := func() int {
+		req, _ := http.NewRequest("GET", server.URL+"/readyz", nil)
+		return status(t, req).StatusCode
+	}
+
+	app.CheckHealth()
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected status %d with a healthy backend, got %d", http.StatusOK, code)
+	}
+	atomic.StoreInt32(&failing, 1)
+	app.CheckHealth()
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d with every backend down, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	app.Register(steady.URL, "steady")
+	app.CheckHealth()
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected status %d while any backend is healthy, got %d", http.StatusOK, code)
+	}
+	app.Readiness = ReadyAll
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d when all backends must be healthy, got %d", http.StatusServiceUnavailable, code)
+	}
+	atomic.StoreInt32(&failing, 0)
+	app.CheckHealth()
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected status %d once every backend recovered, got %d", http.StatusOK, code)
+	}
+}
+
+func TestHealthzAndReadyzSkipAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileStore(filepath.Join(dir, "proxies.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	app := NewApp(template.Must(LoadTemplates("")), store)
+	app.Authenticator = BasicAuth{Username: "admin", Password: "secret"}
+	app.Setup()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if body := get(t, server.URL+"/healthz"); body != "ok\n" {
+		t.Errorf("Expected ok from /healthz without credentials, got %q", body)
+	}
+	if body := get(t, server.URL+"/readyz"); body != "ready\n" {
+		t.Errorf("Expected ready from /readyz without credentials, got %q", body)
+	}
+
+	os.RemoveAll(dir)
+	req, _ := http.NewRequest("GET", server.URL+"/readyz", nil)
+	if res := status(t, req); res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d once the store is gone, got %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	req, _ = http.NewRequest("GET", server.URL+"/healthz", nil)
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected /healthz to stay up, got %d", res.StatusCode)
+	}
+}
+
+func TestLoadInBackground(t *testing.T) {
+	app := Subject()
+	release := make(chan struct{})
+	loaded := app.LoadInBackground(func() error {
+		<-release
+		return nil
+	})
+	if app.Ready() {
+		t.Error("Expected the app not to be ready as soon as loading is started")
+	}
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !app.Ready() {
+		t.Error("Expected the app to be ready once loaded")
+	}
+}
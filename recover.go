@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// RecoverPanics turns a panic in any route into a logged stack trace and a
+// 500 page, instead of a reset connection. If the response had already
+// started it can't be replaced, so the connection is aborted as before.
+// http.ErrAbortHandler is passed on untouched: it is how handlers ask for
+// exactly that.
+func (app *App) RecoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			app.Logger.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, recovered, debug.Stack())
+			if sw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			app.renderInternalError(sw)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+func (app *App) renderInternalError(w http.ResponseWriter) {
+	viewContext := NewViewContext()
+	viewContext["Title"] = "reverser-error"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	app.ExecuteTemplate(w, "500.html", viewContext)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	var logged syncBuffer
+	app := Subject()
+	app.Logger = log.New(&logged, "", 0)
+	app.Router.HandleFunc("/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("kaboom")
+	})
+	app.Router.HandleFunc("/half", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("kaboom")
+	})
+	server := httptest.NewUnstartedServer(app.Router)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.Start()
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/boom")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, res.StatusCode)
+	}
+	if !strings.Contains(string(body), "Something went wrong") {
+		t.Errorf("Expected the 500 page, got %s", body)
+	}
+	if !strings.Contains(logged.String(), "panic serving GET /boom: kaboom") {
+		t.Errorf("Expected the panic to be logged with the path, got %s", logged.String())
+	}
+
+	res, err = http.Get(server.URL + "/half")
+	if err == nil {
+		_, err = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	if err == nil {
+		t.Error("Expected a response that had started to be aborted")
+	}
+}
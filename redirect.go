@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const DefaultMaxRedirects = 10
+
+// credentialHeaders are dropped from redirects to another host.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+var (
+	errRedirectLoop     = errors.New("redirect loop")
+	errTooManyRedirects = errors.New("too many redirects")
+)
+
+// redirectTransport follows upstream redirects itself instead of passing
+// them to the client. A redirect back to a URL already visited is a loop and
+// fails straight away rather than spending the rest of the hops. Like
+// net/http's client, credentials aren't sent on to other hosts.
+type redirectTransport struct {
+	next http.RoundTripper
+	max  int
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	seen := map[string]bool{req.URL.String(): true}
+	origin := req.URL.Hostname()
+	for hops := 0; ; hops++ {
+		res, err := t.next.RoundTrip(req)
+		if err != nil {
+			return res, err
+		}
+		location, err := res.Location()
+		if err != nil || !redirectStatus(res.StatusCode) {
+			return res, nil
+		}
+		next, ok := redirectRequest(req, res.StatusCode)
+		if !ok {
+			return res, nil
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+		res.Body.Close()
+		if seen[location.String()] {
+			return nil, fmt.Errorf("%w to %s", errRedirectLoop, location)
+		}
+		if hops >= t.max {
+			return nil, fmt.Errorf("%w: stopped after %d", errTooManyRedirects, t.max)
+		}
+		seen[location.String()] = true
+		next.URL = location
+		next.Host = hostHeader(location)
+		if !credentialScope(origin, location.Hostname()) {
+			for _, name := range credentialHeaders {
+				next.Header.Del(name)
+			}
+		}
+		req = next
+	}
+}
+
+// credentialScope reports whether credentials sent to origin may follow a
+// redirect to host: the same host or one of its subdomains, as net/http's
+// client decides. Ports don't matter.
+func credentialScope(origin string, host string) bool {
+	origin, host = strings.ToLower(origin), strings.ToLower(host)
+	return host == origin || strings.HasSuffix(host, "."+origin)
+}
+
+func redirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectRequest builds the request for the next hop the way browsers do:
+// 307 and 308 repeat the method and body, the others become a bodiless GET
+// (HEAD stays HEAD). It reports false when the body can't be replayed.
+func redirectRequest(req *http.Request, code int) (*http.Request, bool) {
+	next := req.Clone(req.Context())
+	if code == http.StatusTemporaryRedirect || code == http.StatusPermanentRedirect {
+		if req.Body == nil || req.Body == http.NoBody {
+			return next, true
+		}
+		if req.GetBody == nil {
+			return nil, false
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, false
+		}
+		next.Body = body
+		return next, true
+	}
+	if req.Method != "HEAD" {
+		next.Method = "GET"
+	}
+	next.Body = nil
+	next.GetBody = nil
+	next.ContentLength = 0
+	next.Header.Del("Content-Type")
+	next.Header.Del("Content-Length")
+	return next, true
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFollowRedirects(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/end", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/bounce":
+			http.Redirect(w, r, "/back", http.StatusFound)
+		case "/back":
+			http.Redirect(w, r, "/bounce", http.StatusFound)
+		default:
+			w.Write([]byte("done"))
+		}
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.RegisterWithOptions(backend.URL, "follow", ProxyOptions{FollowRedirects: true})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	res, err := client.Get(server.URL + "/proxy/follow/start")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "done" {
+		t.Errorf("Expected the redirect to be followed, got %d %q", res.StatusCode, body)
+	}
+
+	for _, path := range []string{"/loop", "/bounce"} {
+		res, err := client.Get(server.URL + "/proxy/follow" + path)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusLoopDetected {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusLoopDetected, path, res.StatusCode)
+		}
+	}
+}
+
+func TestFollowRedirectsCapsHops(t *testing.T) {
+	hops := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hops++
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.RegisterWithOptions(backend.URL, "follow", ProxyOptions{FollowRedirects: true, MaxRedirects: 3})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/proxy/follow/a")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, res.StatusCode)
+	}
+	if hops != 4 {
+		t.Errorf("Expected 3 redirects followed in 4 upstream requests, got %d", hops)
+	}
+}
+
+func TestFollowRedirectsUpToMax(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/end", http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "follow", ProxyOptions{FollowRedirects: true, MaxRedirects: 1})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if body := get(t, server.URL+"/proxy/follow/start"); body != "done" {
+		t.Errorf("Expected the one allowed redirect to be followed, got %q", body)
+	}
+}
+
+func TestFollowRedirectsDropsCredentialsAcrossHosts(t *testing.T) {
+	var sameHost, otherHost http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHost = r.Header.Clone()
+	}))
+	defer other.Close()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/away":
+			http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1)+"/landed", http.StatusFound)
+		case "/here":
+			http.Redirect(w, r, "/landed", http.StatusFound)
+		default:
+			sameHost = r.Header.Clone()
+		}
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "follow", ProxyOptions{FollowRedirects: true})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	for _, path := range []string{"/here", "/away"} {
+		req, _ := http.NewRequest("GET", server.URL+"/proxy/follow"+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "session=abc")
+		status(t, req)
+	}
+	if sameHost.Get("Authorization") != "Bearer secret" || sameHost.Get("Cookie") != "session=abc" {
+		t.Errorf("Expected credentials kept on the same host, got %v", sameHost)
+	}
+	if otherHost == nil {
+		t.Fatal("Expected the redirect to the other host to be followed")
+	}
+	if otherHost.Get("Authorization") != "" || otherHost.Get("Cookie") != "" {
+		t.Errorf("Expected credentials dropped on another host, got %v", otherHost)
+	}
+}
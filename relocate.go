@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// withProxyPrefix remembers the path the proxy is reached under, so
+// responses can be rewritten to point back at it.
+func withProxyPrefix(r *http.Request, prefix string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), proxyPrefixKey, prefix))
+}
+
+// rewriteResponseURLs points redirects and cookies that name the upstream
+// back at the proxy, for RewriteRedirects and RewriteCookies.
+func (p *Proxy) rewriteResponseURLs(res *http.Response) error {
+	if !p.RewriteRedirects && !p.RewriteCookies || res.Request == nil {
+		return nil
+	}
+	prefix, _ := res.Request.Context().Value(proxyPrefixKey).(string)
+	target := p.backendFor(res.Request.URL)
+	if target == nil {
+		target = p.URL
+	}
+	if p.RewriteRedirects {
+		p.rewriteLocation(res, target, prefix)
+	}
+	if p.RewriteCookies {
+		p.rewriteCookies(res, target, prefix)
+	}
+	return nil
+}
+
+// rewriteLocation maps a Location on one of the backends, or an absolute
+// path on the one that answered, under prefix.
+func (p *Proxy) rewriteLocation(res *http.Response, target *url.URL, prefix string) {
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || location.String() == "" {
+		return
+	}
+	if location.Host != "" {
+		if target = p.backendFor(location); target == nil {
+			return
+		}
+	} else if !strings.HasPrefix(location.Path, "/") {
+		return
+	}
+	rewritten := url.URL{Path: proxiedPath(location.Path, target, prefix), RawQuery: location.RawQuery, Fragment: location.Fragment}
+	res.Header.Set("Location", rewritten.String())
+}
+
+// rewriteCookies drops a Domain naming the backend, leaving the cookie on
+// the proxy's host, and moves the Path under prefix.
+func (p *Proxy) rewriteCookies(res *http.Response, target *url.URL, prefix string) {
+	cookies := res.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	res.Header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		if cookie.Domain != "" && strings.EqualFold(strings.TrimPrefix(cookie.Domain, "."), target.Hostname()) {
+			cookie.Domain = ""
+		}
+		path := cookie.Path
+		if path == "" {
+			path = "/"
+		}
+		cookie.Path = proxiedPath(path, target, prefix)
+		if line := cookie.String(); line != "" {
+			res.Header.Add("Set-Cookie", line)
+		}
+	}
+}
+
+// backendFor returns the backend or canary u is on, or nil.
+func (p *Proxy) backendFor(u *url.URL) *url.URL {
+	if u == nil || u.Host == "" {
+		return nil
+	}
+	for _, backend := range p.Backends {
+		if strings.EqualFold(backend.Host, u.Host) {
+			return backend
+		}
+	}
+	if p.Canary != nil && strings.EqualFold(p.Canary.Host, u.Host) {
+		return p.Canary
+	}
+	return nil
+}
+
+// proxiedPath is where the client reaches the upstream path through the
+// proxy: the target's own path is swapped for prefix.
+func proxiedPath(path string, target *url.URL, prefix string) string {
+	if targetPath := strings.TrimSuffix(target.Path, "/"); targetPath != "" {
+		if path == targetPath || strings.HasPrefix(path, targetPath+"/") {
+			path = strings.TrimPrefix(path, targetPath)
+		}
+	}
+	if path = joinPath(prefix, path); path == "" {
+		return "/"
+	}
+	return path
+}
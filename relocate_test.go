@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRewriteRedirectsAndCookies(t *testing.T) {
+	var backend *httptest.Server
+	backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app/absolute":
+			w.Header().Set("Location", backend.URL+"/app/login?next=%2F")
+		case "/app/rooted":
+			w.Header().Set("Location", "/app/home")
+		case "/app/elsewhere":
+			w.Header().Set("Location", "https://example.com/")
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/app/", Domain: "127.0.0.1"})
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL+"/app", "rw", ProxyOptions{RewriteRedirects: true, RewriteCookies: true})
+	app.RegisterWithOptions(backend.URL+"/app", "plain", ProxyOptions{})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	locations := map[string]string{
+		"/proxy/rw/absolute":  "/proxy/rw/login?next=%2F",
+		"/proxy/rw/rooted":    "/proxy/rw/home",
+		"/proxy/rw/elsewhere": "https://example.com/",
+		"/proxy/plain/rooted": "/app/home",
+	}
+	for path, expected := range locations {
+		res, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		res.Body.Close()
+		if location := res.Header.Get("Location"); location != expected {
+			t.Errorf("Expected %s to redirect to %s, got %s", path, expected, location)
+		}
+	}
+
+	res, err := client.Get(server.URL + "/proxy/rw/absolute")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if cookie := res.Header.Get("Set-Cookie"); cookie != "session=1; Path=/proxy/rw/" {
+		t.Errorf("Expected the cookie moved under the proxy, got %s", cookie)
+	}
+	res, err = client.Get(server.URL + "/proxy/plain/absolute")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if cookie := res.Header.Get("Set-Cookie"); cookie != "session=1; Path=/app/; Domain=127.0.0.1" {
+		t.Errorf("Expected the cookie untouched without RewriteCookies, got %s", cookie)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryRatio   = 0.2
+	DefaultMinRetries   = 10
+	DefaultRetryWindow  = 10 * time.Second
+	DefaultRetryBackoff = 25 * time.Millisecond
+)
+
+// RetryBudget caps retries to a fraction of the requests seen in a window, so
+// a broadly failing backend isn't hit with a multiple of its normal load.
+// MinRetries are always allowed per window so low-traffic proxies can still
+// retry.
+type RetryBudget struct {
+	sync.Mutex
+	Ratio      float64
+	MinRetries int
+	Window     time.Duration
+
+	now      func() time.Time
+	start    time.Time
+	requests int
+	retries  int
+}
+
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	return &RetryBudget{Ratio: ratio, MinRetries: minRetries, Window: window, now: time.Now}
+}
+
+func (b *RetryBudget) roll() {
+	now := b.now()
+	if now.Sub(b.start) >= b.Window {
+		b.start = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// Request records a request against the budget.
+func (b *RetryBudget) Request() {
+	b.Lock()
+	defer b.Unlock()
+	b.roll()
+	b.requests++
+}
+
+// AllowRetry reports whether a retry fits in the budget, spending it if so.
+func (b *RetryBudget) AllowRetry() bool {
+	b.Lock()
+	defer b.Unlock()
+	b.roll()
+	if float64(b.retries) >= float64(b.MinRetries)+b.Ratio*float64(b.requests) {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// retryable reports whether err means the upstream couldn't be reached or
+// dropped the connection, rather than answering. Everything else, such as a
+// redirect loop or a timeout, would only fail the same way again.
+func retryable(err error) bool {
+	if errors.Is(err, errRedirectLoop) || errors.Is(err, errTooManyRedirects) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func idempotent(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// retriesFor is how many times proxy retries: its own Retries, or the app's
+// when it has none. A negative Retries turns retries off for the proxy.
+func (app *App) retriesFor(proxy *Proxy) int {
+	if proxy.Retries != 0 {
+		return proxy.Retries
+	}
+	return app.Retries
+}
+
+// retryTransport retries idempotent requests that couldn't connect to the
+// upstream, as long as the budget allows. Requests with a body are only retried when
+// it can be replayed, see BufferBody. Each retry waits twice as long as the
+// one before, starting at backoff.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	budget  *RetryBudget
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.budget != nil {
+		t.budget.Request()
+	}
+	res, err := t.next.RoundTrip(req)
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if !idempotent(req.Method) || (hasBody && req.GetBody == nil) {
+		return res, err
+	}
+	for attempt := 0; err != nil && retryable(err) && attempt < t.retries; attempt++ {
+		if req.Context().Err() != nil {
+			break
+		}
+		if t.budget != nil && !t.budget.AllowRetry() {
+			break
+		}
+		if !sleep(req.Context(), t.backoff<<attempt) {
+			break
+		}
+		retry := req
+		if hasBody {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				break
+			}
+			retry = req.Clone(req.Context())
+			retry.Body = body
+		}
+		res, err = t.next.RoundTrip(retry)
+	}
+	return res, err
+}
+
+// sleep waits for d, reporting false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
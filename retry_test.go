@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type failingTransport struct {
+	sync.Mutex
+	attempts int
+}
+
+func (t *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Lock()
+	defer t.Unlock()
+	t.attempts++
+	return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+}
+
+func TestRetryBudgetTapersRetries(t *testing.T) {
+	failing := &failingTransport{}
+	transport := &retryTransport{
+		next:    failing,
+		retries: 3,
+		budget:  NewRetryBudget(0.1, 5, time.Minute),
+	}
+
+	var retried []int
+	for i := 0; i < 100; i++ {
+		before := failing.attempts
+		req, _ := http.NewRequest("GET", "http://backend/", nil)
+		if _, err := transport.RoundTrip(req); err == nil {
+			t.Fatal("Expected the request to fail")
+		}
+		retried = append(retried, failing.attempts-before-1)
+	}
+
+	if retried[0] != 3 {
+		t.Errorf("Expected early requests to be retried 3 times, got %d", retried[0])
+	}
+	if retried[99] != 0 {
+		t.Errorf("Expected retries to stop once the budget is spent, got %d", retried[99])
+	}
+	total := failing.attempts - 100
+	if total > 5+10 {
+		t.Errorf("Expected at most 15 retries within the budget, got %d", total)
+	}
+}
+
+func TestRetryBudgetWindowResets(t *testing.T) {
+	now := time.Now()
+	budget := NewRetryBudget(0, 1, time.Minute)
+	budget.now = func() time.Time { return now }
+
+	if !budget.AllowRetry() {
+		t.Error("Expected the first retry to be allowed")
+	}
+	if budget.AllowRetry() {
+		t.Error("Expected the budget to be exhausted")
+	}
+	now = now.Add(time.Minute)
+	if !budget.AllowRetry() {
+		t.Error("Expected the budget to refill in a new window")
+	}
+}
+
+func TestRetryTransportSkipsNonIdempotent(t *testing.T) {
+	failing := &failingTransport{}
+	transport := &retryTransport{next: failing, retries: 3}
+	req, _ := http.NewRequest("POST", "http://backend/", nil)
+	transport.RoundTrip(req)
+	if failing.attempts != 1 {
+		t.Errorf("Expected POST not to be retried, got %d attempts", failing.attempts)
+	}
+}
+
+func TestRetryAfterConnectionFailure(t *testing.T) {
+	var attempts int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Retries = 2
+	app.Register(backend.URL, "flaky")
+	app.RegisterWithOptions(backend.URL, "noretry", ProxyOptions{Retries: -1})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if body := get(t, server.URL+"/proxy/flaky/"); body != "ok" {
+		t.Errorf("Expected the retry to succeed, got %q", body)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("Expected 2 attempts, got %d", n)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	req, _ := http.NewRequest("POST", server.URL+"/proxy/flaky/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status %d for a POST, got %d", http.StatusBadGateway, res.StatusCode)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("Expected a POST not to be retried, got %d attempts", n)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	req, _ = http.NewRequest("GET", server.URL+"/proxy/noretry/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status %d with retries off, got %d", http.StatusBadGateway, res.StatusCode)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	failing := &failingTransport{}
+	transport := &retryTransport{next: failing, retries: 2, backoff: 20 * time.Millisecond}
+	req, _ := http.NewRequest("GET", "http://backend/", nil)
+	start := time.Now()
+	transport.RoundTrip(req)
+	if failing.attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", failing.attempts)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("Expected retries to back off 20ms then 40ms, took %s", elapsed)
+	}
+}
+
+func TestRetryableErrors(t *testing.T) {
+	retryableErrors := []error{
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")},
+		&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET},
+		fmt.Errorf("wrapped: %w", syscall.ECONNREFUSED),
+	}
+	for _, err := range retryableErrors {
+		if !retryable(err) {
+			t.Errorf("Expected %v to be retried", err)
+		}
+	}
+	permanent := []error{
+		fmt.Errorf("%w to http://backend/", errRedirectLoop),
+		fmt.Errorf("%w: stopped after 10", errTooManyRedirects),
+		context.DeadlineExceeded,
+		errors.New("malformed HTTP response"),
+	}
+	for _, err := range permanent {
+		if retryable(err) {
+			t.Errorf("Expected %v not to be retried", err)
+		}
+	}
+}
+
+func TestRedirectLoopNotRetried(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.RegisterWithOptions(backend.URL, "loop", ProxyOptions{FollowRedirects: true, Retries: 3})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/loop/loop", nil)
+	if res := status(t, req); res.StatusCode != http.StatusLoopDetected {
+		t.Errorf("Expected status %d, got %d", http.StatusLoopDetected, res.StatusCode)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("Expected the loop to hit the upstream once, got %d", n)
+	}
+}
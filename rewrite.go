@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PathRewrite rewrites forwarded paths matching Pattern, a regular
+// expression, to Replacement, which may refer to submatches as in
+// regexp.ReplaceAllString, ex {"^/v1/(.*)$", "/legacy/$1"}.
+type PathRewrite struct {
+	Pattern     string
+	Replacement string
+}
+
+type compiledRewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func compileRewrites(rewrites []PathRewrite) ([]compiledRewrite, error) {
+	var compiled []compiledRewrite
+	for _, rewrite := range rewrites {
+		pattern, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, compiledRewrite{pattern, rewrite.Replacement})
+	}
+	return compiled, nil
+}
+
+// rewritePath applies the first of the proxy's PathRewrites that matches the
+// forwarded path.
+func (p *Proxy) rewritePath(req *http.Request) {
+	for _, rewrite := range p.rewrites {
+		if rewrite.pattern.MatchString(req.URL.Path) {
+			req.URL.Path = rewrite.pattern.ReplaceAllString(req.URL.Path, rewrite.replacement)
+			req.URL.RawPath = ""
+			return
+		}
+	}
+}
+
+// prefixPath prepends the target's own path, so a proxy registered for
+// http://backend/api forwards /x as /api/x. Targets without a path are
+// served from their root.
+func prefixPath(req *http.Request, target *url.URL) {
+	if target.Path == "" || target.Path == "/" {
+		return
+	}
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = joinPath(target.EscapedPath(), req.URL.RawPath)
+	}
+	req.URL.Path = joinPath(target.Path, req.URL.Path)
+}
+
+func joinPath(prefix, path string) string {
+	if path == "" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTargetPathAndRewrites(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "root")
+	app.Register(backend.URL+"/api", "prefixed")
+	app.RegisterWithOptions(backend.URL+"/api/", "rewritten", ProxyOptions{
+		PathRewrites: []PathRewrite{{Pattern: "^/v1/(.*)$", Replacement: "/legacy/$1"}},
+	})
+	if err := app.RegisterWithOptions(backend.URL, "invalid", ProxyOptions{
+		PathRewrites: []PathRewrite{{Pattern: "("}},
+	}); err == nil {
+		t.Error("Expected an invalid rewrite pattern to be rejected")
+	}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	cases := map[string]string{
+		"/proxy/root/x/y?q=1":       "/x/y?q=1",
+		"/proxy/prefixed/x/y?q=1":   "/api/x/y?q=1",
+		"/proxy/prefixed":           "/api",
+		"/proxy/prefixed/":          "/api/",
+		"/proxy/rewritten/v1/users": "/api/legacy/users",
+		"/proxy/rewritten/v2/users": "/api/v2/users",
+	}
+	for path, want := range cases {
+		if got := get(t, server.URL+path); got != want {
+			t.Errorf("Expected %s to be forwarded as %s, got %s", path, want, got)
+		}
+	}
+}
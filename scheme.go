@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseDefaultScheme checks a -default-scheme value. Empty leaves
+// schemeless targets to be rejected.
+func ParseDefaultScheme(scheme string) (string, error) {
+	switch scheme {
+	case "", "http", "https":
+		return scheme, nil
+	}
+	return "", fmt.Errorf("default scheme must be http or https, got %q", scheme)
+}
+
+// NormalizeTarget prefixes each comma separated target that has no scheme,
+// ex backend:8080, with app.DefaultScheme.
+func (app *App) NormalizeTarget(target string) string {
+	if app.DefaultScheme == "" {
+		return target
+	}
+	parts := strings.Split(target, ",")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part != "" && !strings.Contains(part, "://") {
+			part = app.DefaultScheme + "://" + part
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, ",")
+}
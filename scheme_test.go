@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDefaultScheme(t *testing.T) {
+	app := Subject()
+	if err := app.Register("backend:8080", "bare"); err == nil {
+		t.Error("Expected a schemeless target to be rejected without a default scheme")
+	}
+
+	app.DefaultScheme = "http"
+	if err := app.Register("backend:8080, https://other:8443", "bare"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	proxy, _ := app.Find("bare")
+	if target := proxy.Target(); target != "http://backend:8080,https://other:8443" {
+		t.Errorf("Expected the target to be normalized, got %s", target)
+	}
+
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	form := url.Values{"path": {"form"}, "target": {"backend:9000"}}
+	res, err := client.Post(server.URL+"/register", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Errorf("Expected the form to accept a schemeless target, got %d", res.StatusCode)
+	}
+	if proxy, err := app.Find("form"); err != nil || proxy.URL.String() != "http://backend:9000" {
+		t.Errorf("Expected the form target to be normalized, got %v %v", proxy, err)
+	}
+}
+
+func TestParseDefaultScheme(t *testing.T) {
+	if _, err := ParseDefaultScheme("ftp"); err == nil {
+		t.Error("Expected ftp to be rejected as a default scheme")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var securityHeaders = []string{"Content-Security-Policy", "X-Content-Type-Options", "X-Frame-Options"}
+
+func TestSecurityHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "testing")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	for _, path := range []string{"/", "/register"} {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		res.Body.Close()
+		for _, header := range securityHeaders {
+			if res.Header.Get(header) == "" {
+				t.Errorf("Expected %s header on %s", header, path)
+			}
+		}
+	}
+
+	res, err := http.Get(server.URL + "/proxy/testing/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	for _, header := range securityHeaders {
+		if res.Header.Get(header) != "" {
+			t.Errorf("Expected no %s header on proxied response", header)
+		}
+	}
+}
+
+func TestTemplatesEscapeUserInput(t *testing.T) {
+	app := Subject()
+	app.Register("http://localhost:9000/?q=<script>", "<script>alert(1)</script>")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if strings.Contains(string(content), "<script>") {
+		t.Errorf("Expected user input to be escaped, got %s", content)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+)
+
+// Register, Update and their WithOptions variants expand and normalize the
+// target and check it against the listen address, the path against
+// MaxPathLength and the Hosts against the admin host, before handing them to
+// the store.
+func (app *App) Register(target string, path string) error {
+	return app.RegisterWithOptions(target, path, ProxyOptions{})
+}
+
+// RegisterProxy registers target under path like Register and returns the
+// stored proxy.
+func (app *App) RegisterProxy(target string, path string) (*Proxy, error) {
+	if err := app.Register(target, path); err != nil {
+		return nil, err
+	}
+	return app.Find(NormalizePath(path))
+}
+
+func (app *App) RegisterWithOptions(target string, path string, opts ProxyOptions) error {
+	target, err := app.prepareTarget(target)
+	if err != nil {
+		return err
+	}
+	if err := app.checkPathLength(path); err != nil {
+		return err
+	}
+	if err := app.checkSelfTarget(target); err != nil {
+		return err
+	}
+	if err := app.checkHosts(opts.Hosts); err != nil {
+		return err
+	}
+	return app.DataStore.RegisterWithOptions(target, path, opts)
+}
+
+func (app *App) Update(target string, path string) error {
+	target, err := app.prepareTarget(target)
+	if err != nil {
+		return err
+	}
+	if err := app.checkSelfTarget(target); err != nil {
+		return err
+	}
+	return app.DataStore.Update(target, path)
+}
+
+func (app *App) Rename(oldPath string, newPath string) error {
+	if err := app.checkPathLength(newPath); err != nil {
+		return err
+	}
+	return app.DataStore.Rename(oldPath, newPath)
+}
+
+func (app *App) UpdateWithOptions(target string, path string, opts ProxyOptions) error {
+	target, err := app.prepareTarget(target)
+	if err != nil {
+		return err
+	}
+	if err := app.checkPathLength(path); err != nil {
+		return err
+	}
+	if err := app.checkSelfTarget(target); err != nil {
+		return err
+	}
+	if err := app.checkHosts(opts.Hosts); err != nil {
+		return err
+	}
+	return app.DataStore.UpdateWithOptions(target, path, opts)
+}
+
+// targetPreparer is implemented by stores that expand and normalize targets
+// as they register them, such as App.
+type targetPreparer interface {
+	prepareTarget(target string) (string, error)
+}
+
+// preparedTarget returns target as store will register it, so forms can
+// validate it. Forms submit the target as typed; expanding it there as well
+// would expand a $ in a variable's value a second time.
+func preparedTarget(store DataStore, target string) (string, error) {
+	if preparer, ok := store.(targetPreparer); ok {
+		return preparer.prepareTarget(target)
+	}
+	return target, nil
+}
+
+// prepareTarget expands environment variables in target and adds the
+// default scheme.
+func (app *App) prepareTarget(target string) (string, error) {
+	target, err := ExpandTarget(target)
+	if err != nil {
+		return "", err
+	}
+	return app.NormalizeTarget(target), nil
+}
+
+// checkSelfTarget warns about, or in strict mode rejects, targets that point
+// back at reverser's own listen address and would loop forever.
+func (app *App) checkSelfTarget(target string) error {
+	if app.ListenAddr == "" {
+		return nil
+	}
+	targets, err := ParseTargets(target)
+	if err != nil {
+		return nil
+	}
+	for _, targetURL := range targets {
+		if !pointsAt(targetURL, app.ListenAddr) {
+			continue
+		}
+		err := fmt.Errorf("target %s points at reverser's own listen address %s", targetURL, app.ListenAddr)
+		if app.Strict {
+			return err
+		}
+		app.Logger.Printf("warning: %s", err)
+	}
+	return nil
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+func isLocalHost(host string) bool {
+	if host == "localhost" || host == "" {
+		return true
+	}
+	if hostname, err := os.Hostname(); err == nil && host == hostname {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// pointsAt reports whether target would connect to listenAddr. A listen
+// address without a host, or on 0.0.0.0, matches any local host name.
+func pointsAt(target *url.URL, listenAddr string) bool {
+	listenHost, listenPort, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return false
+	}
+	port := target.Port()
+	if port == "" {
+		port = defaultPort(target.Scheme)
+	}
+	if port != listenPort {
+		return false
+	}
+	host := target.Hostname()
+	if listenHost == "" || net.ParseIP(listenHost) != nil && net.ParseIP(listenHost).IsUnspecified() {
+		return isLocalHost(host)
+	}
+	return host == listenHost || isLocalHost(host) && isLocalHost(listenHost)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestSelfTargetWarning(t *testing.T) {
+	var logged bytes.Buffer
+	app := Subject()
+	app.Logger = log.New(&logged, "", 0)
+	app.ListenAddr = ":8000"
+
+	if err := app.Register("http://localhost:8000", "loop"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !strings.Contains(logged.String(), "own listen address") {
+		t.Errorf("Expected a warning, got %q", logged.String())
+	}
+	if _, err := app.Find("loop"); err != nil {
+		t.Errorf("Expected the proxy to be registered outside strict mode, got %s", err)
+	}
+}
+
+func TestSelfTargetStrict(t *testing.T) {
+	app := Subject()
+	app.ListenAddr = "127.0.0.1:8000"
+	app.Strict = true
+
+	if err := app.Register("http://127.0.0.1:8000/app", "loop"); err == nil {
+		t.Error("Expected the self-targeting proxy to be rejected")
+	}
+	if _, err := app.Find("loop"); err == nil {
+		t.Error("Expected the rejected proxy not to be registered")
+	}
+	if err := app.Register("http://127.0.0.1:9000", "other"); err != nil {
+		t.Errorf("Expected a different port to be accepted, got %s", err)
+	}
+	if err := app.Register("http://example.com:8000", "remote"); err != nil {
+		t.Errorf("Expected a remote host to be accepted, got %s", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// announceServerTiming declares the Server-Timing trailer before the
+// response starts, so it can be set once the body has been streamed.
+func announceServerTiming(w http.ResponseWriter) {
+	w.Header().Add("Trailer", "Server-Timing")
+}
+
+// unframeForTrailer drops the response's Content-Length. Trailers can only
+// follow a chunked body.
+func unframeForTrailer(res *http.Response) {
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+}
+
+// setServerTiming sets the Server-Timing trailer to the request's total
+// duration in milliseconds.
+func setServerTiming(w http.ResponseWriter, duration time.Duration) {
+	w.Header().Set("Server-Timing", fmt.Sprintf("total;dur=%.3f", milliseconds(duration)))
+}
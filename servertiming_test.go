@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerTimingTrailer(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4")
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "timed", ProxyOptions{ServerTiming: true})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/proxy/timed/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if _, ok := res.Trailer["Server-Timing"]; !ok {
+		t.Errorf("Expected Server-Timing to be announced, got %v", res.Header)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "body" {
+		t.Errorf("Expected the body, got %q", body)
+	}
+
+	timing := res.Trailer.Get("Server-Timing")
+	if !strings.HasPrefix(timing, "total;dur=") {
+		t.Fatalf("Expected a Server-Timing trailer, got %q", timing)
+	}
+	duration, err := strconv.ParseFloat(strings.TrimPrefix(timing, "total;dur="), 64)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if duration < 20 || duration > 5000 {
+		t.Errorf("Expected a plausible duration in milliseconds, got %f", duration)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// DefaultBufferMemoryLimit is how much of a buffered request body is kept in
+// memory before the rest is spooled to a temporary file.
+const DefaultBufferMemoryLimit = 1 << 20
+
+// spooledBody is a request body read in full so it can be replayed: in
+// memory when small, otherwise in a temporary file.
+type spooledBody struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+// spoolError is a failure of the temporary file, as opposed to reading the
+// client's body.
+type spoolError struct {
+	err error
+}
+
+func (e *spoolError) Error() string {
+	return "spooling request body: " + e.err.Error()
+}
+
+// readErrors records the last error reading from a Reader.
+type readErrors struct {
+	io.Reader
+	err error
+}
+
+func (r *readErrors) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// spoolBody reads body, keeping up to memoryLimit bytes in memory and
+// spilling anything larger to a temporary file in dir. Failures of the
+// temporary file are returned as a *spoolError.
+func spoolBody(body io.Reader, memoryLimit int64, dir string) (*spooledBody, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(body, memoryLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) <= memoryLimit {
+		return &spooledBody{data: data, size: int64(len(data))}, nil
+	}
+	file, err := ioutil.TempFile(dir, "reverser-body-")
+	if err != nil {
+		return nil, &spoolError{err}
+	}
+	s := &spooledBody{file: file}
+	if _, err := file.Write(data); err != nil {
+		s.Close()
+		return nil, &spoolError{err}
+	}
+	src := &readErrors{Reader: body}
+	rest, err := io.Copy(file, src)
+	if err != nil {
+		s.Close()
+		if src.err == nil {
+			return nil, &spoolError{err}
+		}
+		return nil, err
+	}
+	s.size = int64(len(data)) + rest
+	return s, nil
+}
+
+// Reader returns a new reader over the whole body.
+func (s *spooledBody) Reader() io.ReadCloser {
+	if s.file == nil {
+		return ioutil.NopCloser(bytes.NewReader(s.data))
+	}
+	return ioutil.NopCloser(io.NewSectionReader(s.file, 0, s.size))
+}
+
+// Close removes the temporary file, if there is one.
+func (s *spooledBody) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// bufferBody reads the request body in full for BufferBody proxies, so a
+// retry can replay it. The returned spool must be closed once the request is
+// done.
+func (app *App) bufferBody(proxy *Proxy, r *http.Request) (*spooledBody, error) {
+	limit := proxy.BufferMemoryLimit
+	if limit <= 0 {
+		limit = DefaultBufferMemoryLimit
+	}
+	spool, err := spoolBody(r.Body, limit, app.SpoolDir)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = spool.Reader()
+	r.ContentLength = spool.size
+	r.GetBody = func() (io.ReadCloser, error) {
+		return spool.Reader(), nil
+	}
+	return spool, nil
+}
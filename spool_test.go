@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestBufferBodySpoolsToDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	payload := make([]byte, 3<<20)
+	rand.Read(payload)
+	type upload struct {
+		sum     [32]byte
+		spooled int
+	}
+	received := make(chan upload, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		files, _ := ioutil.ReadDir(dir)
+		received <- upload{sha256.Sum256(body), len(files)}
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.SpoolDir = dir
+	app.RegisterWithOptions(backend.URL, "uploads", ProxyOptions{BufferBody: true, BufferMemoryLimit: 64 << 10})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/proxy/uploads/", "application/octet-stream", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+
+	got := <-received
+	if got.sum != sha256.Sum256(payload) {
+		t.Error("Expected the backend to receive the full body")
+	}
+	if got.spooled != 1 {
+		t.Errorf("Expected the body to be spooled to a file while proxying, found %d", got.spooled)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the spool file to be removed, found %d files", len(files))
+	}
+}
+
+// flakyTransport fails the first attempt and records the body of the rest.
+type flakyTransport struct {
+	attempts int
+	bodies   []string
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.attempts++
+	body, _ := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if t.attempts == 1 {
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	t.bodies = append(t.bodies, string(body))
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestRetryReplaysBufferedBody(t *testing.T) {
+	spool, err := spoolBody(bytes.NewReader([]byte("replayed")), 4, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer spool.Close()
+
+	flaky := &flakyTransport{}
+	transport := &retryTransport{next: flaky, retries: 2}
+	req, _ := http.NewRequest("GET", "http://backend/", spool.Reader())
+	req.GetBody = func() (io.ReadCloser, error) { return spool.Reader(), nil }
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if flaky.attempts != 2 || len(flaky.bodies) != 1 || flaky.bodies[0] != "replayed" {
+		t.Errorf("Expected the retry to replay the body, got %d attempts and %v", flaky.attempts, flaky.bodies)
+	}
+}
+
+// failingReader returns data, then fails.
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestSpoolErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = spoolBody(&failingReader{data: []byte("partial body")}, 4, dir)
+	if _, ok := err.(*spoolError); err == nil || ok {
+		t.Errorf("Expected a client body error, got %v", err)
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	app := Subject()
+	app.SpoolDir = dir + "/missing"
+	app.RegisterWithOptions(backend.URL, "uploads", ProxyOptions{BufferBody: true, BufferMemoryLimit: 4})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/proxy/uploads/", "text/plain", bytes.NewReader([]byte("spooled to disk")))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status %d when the spool can't be written, got %d", http.StatusInternalServerError, res.StatusCode)
+	}
+}
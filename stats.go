@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsWindow is how many one-minute buckets of history a proxy keeps.
+const MetricsWindow = 60
+
+type bucket struct {
+	minute   int64
+	requests int64
+	latency  time.Duration
+}
+
+// MetricsBucket is one minute of request history.
+type MetricsBucket struct {
+	Minute       time.Time `json:"minute"`
+	Requests     int64     `json:"requests"`
+	AvgLatencyMS float64   `json:"avg_latency_ms"`
+}
+
+// ProxyStats holds the runtime counters of a proxy. It is shared by every copy
+// of the proxy the store hands out, so counters survive group merges and
+// renames.
+type ProxyStats struct {
+	inFlight int64
+
+	sync.Mutex
+	buckets [MetricsWindow]bucket
+
+	Latency QuantileTracker
+
+	// Duration buckets the latency of requests that went upstream.
+	Duration Histogram
+
+	// statuses counts responses by status code, under the mutex.
+	statuses map[int]int64
+}
+
+// Begin and End bracket a proxied request.
+func (s *ProxyStats) Begin() {
+	atomic.AddInt64(&s.inFlight, 1)
+}
+
+func (s *ProxyStats) End(latency time.Duration) {
+	atomic.AddInt64(&s.inFlight, -1)
+	s.record(time.Now(), latency)
+	s.Latency.Observe(latency)
+	s.Duration.Observe(latency)
+}
+
+// CountStatus records the status of a response the proxy sent, whether or
+// not the request went upstream.
+func (s *ProxyStats) CountStatus(code int) {
+	s.Lock()
+	defer s.Unlock()
+	if s.statuses == nil {
+		s.statuses = make(map[int]int64)
+	}
+	s.statuses[code]++
+}
+
+// Statuses returns the number of responses sent for each status code.
+func (s *ProxyStats) Statuses() map[int]int64 {
+	s.Lock()
+	defer s.Unlock()
+	statuses := make(map[int]int64, len(s.statuses))
+	for code, count := range s.statuses {
+		statuses[code] = count
+	}
+	return statuses
+}
+
+// InFlight is the number of requests currently being proxied.
+func (s *ProxyStats) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// record adds a request to the bucket for its minute, reusing the slot of the
+// minute an hour earlier.
+func (s *ProxyStats) record(now time.Time, latency time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	minute := now.Unix() / 60
+	b := &s.buckets[minute%MetricsWindow]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.requests++
+	b.latency += latency
+}
+
+// Buckets returns the last hour of history, oldest first, with a bucket for
+// every minute including idle ones.
+func (s *ProxyStats) Buckets(now time.Time) []MetricsBucket {
+	s.Lock()
+	defer s.Unlock()
+	current := now.Unix() / 60
+	result := make([]MetricsBucket, 0, MetricsWindow)
+	for minute := current - MetricsWindow + 1; minute <= current; minute++ {
+		entry := MetricsBucket{Minute: time.Unix(minute*60, 0).UTC()}
+		if b := s.buckets[minute%MetricsWindow]; b.minute == minute && b.requests > 0 {
+			entry.Requests = b.requests
+			entry.AvgLatencyMS = float64(b.latency) / float64(b.requests) / float64(time.Millisecond)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatsBuckets(t *testing.T) {
+	stats := &ProxyStats{}
+	now := time.Date(2020, 1, 1, 12, 0, 30, 0, time.UTC)
+	stats.record(now.Add(-2*time.Hour), time.Second)
+	stats.record(now.Add(-time.Minute), 10*time.Millisecond)
+	stats.record(now, 10*time.Millisecond)
+	stats.record(now, 30*time.Millisecond)
+
+	buckets := stats.Buckets(now)
+	if len(buckets) != MetricsWindow {
+		t.Fatalf("Expected %d buckets, got %d", MetricsWindow, len(buckets))
+	}
+	last := buckets[MetricsWindow-1]
+	if !last.Minute.Equal(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the last bucket to be the current minute, got %s", last.Minute)
+	}
+	if last.Requests != 2 || last.AvgLatencyMS != 20 {
+		t.Errorf("Expected 2 requests averaging 20ms, got %d averaging %f", last.Requests, last.AvgLatencyMS)
+	}
+	if buckets[MetricsWindow-2].Requests != 1 {
+		t.Errorf("Expected 1 request in the previous minute, got %d", buckets[MetricsWindow-2].Requests)
+	}
+	var total int64
+	for _, b := range buckets {
+		total += b.Requests
+	}
+	if total != 3 {
+		t.Errorf("Expected requests older than an hour to drop out, got %d in total", total)
+	}
+}
+
+func TestProxyMetricsEndpoint(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "charted")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		get(t, server.URL+"/proxy/charted/")
+	}
+
+	res, err := http.Get(server.URL + "/api/proxies/charted/metrics")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	var buckets []MetricsBucket
+	if err := json.NewDecoder(res.Body).Decode(&buckets); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	var total int64
+	for _, b := range buckets {
+		total += b.Requests
+	}
+	if total != 3 {
+		t.Errorf("Expected 3 requests in the buckets, got %d", total)
+	}
+}
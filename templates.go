@@ -0,0 +1,40 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"os"
+	"path/filepath"
+)
+
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+// DefaultTemplates is where templates are looked for on disk. When nothing
+// matches, the built-in copies are used.
+const DefaultTemplates = "templates/*.html"
+
+// LoadTemplates parses the built-in templates and then the files matching
+// pattern, which replace the built-in template of the same name. pattern may
+// also be a directory, meaning the *.html files in it. An empty pattern uses
+// the built-in templates only.
+func LoadTemplates(pattern string) (*template.Template, error) {
+	templates, err := template.ParseFS(defaultTemplates, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if pattern == "" {
+		return templates, nil
+	}
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*.html")
+	}
+	overrides, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) == 0 {
+		return templates, nil
+	}
+	return templates.ParseFiles(overrides...)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, url string) string {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer res.Body.Close()
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return string(content)
+}
+
+func TestLoadTemplatesOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+	custom := `{{ template "_header.html" . }}<h2>Custom Theme</h2>{{ template "_footer.html" }}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(custom), 0644); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	app := NewApp(templates, NewStore())
+	app.Setup()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if content := get(t, server.URL+"/"); !strings.Contains(content, "Custom Theme") {
+		t.Errorf("Expected the overridden index.html, got %s", content)
+	}
+	if content := get(t, server.URL+"/register"); !strings.Contains(content, "Setup new Proxy") {
+		t.Errorf("Expected the built-in register.html, got %s", content)
+	}
+}
+
+func TestIndexEmptyState(t *testing.T) {
+	app := Subject()
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	if body := get(t, server.URL+"/"); !strings.Contains(body, "Add your first proxy") {
+		t.Errorf("Expected the onboarding section with no proxies, got %s", body)
+	}
+
+	app.Register("http://example.com", "example")
+	body := get(t, server.URL+"/")
+	if strings.Contains(body, "Add your first proxy") {
+		t.Errorf("Expected no onboarding section once a proxy is registered, got %s", body)
+	}
+	if !strings.Contains(body, "example") {
+		t.Errorf("Expected the proxy list, got %s", body)
+	}
+}
+
+func TestLoadTemplatesGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+	custom := `{{ template "_header.html" . }}<h2>Globbed</h2>{{ template "_footer.html" }}`
+	ioutil.WriteFile(filepath.Join(dir, "index.tmpl"), []byte(custom), 0644)
+
+	templates, err := LoadTemplates(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if templates.Lookup("index.tmpl") == nil || templates.Lookup("register.html") == nil {
+		t.Errorf("Expected the globbed template alongside the built-in ones, got %s", templates.DefinedTemplates())
+	}
+	if _, err := LoadTemplates(filepath.Join(dir, "missing", "*.html")); err != nil {
+		t.Errorf("Expected a pattern matching nothing to fall back to the built-in templates, got %s", err)
+	}
+}
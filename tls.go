@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// listenConfig is where and how reverser serves. With a certificate and key
+// it serves HTTPS, on TLSAddr alongside plain HTTP on Addr when TLSAddr is
+// set and on Addr alone otherwise. With ClientCAFile it asks clients for a
+// certificate and verifies any they send against those CAs, so the
+// X-Client-Cert headers only ever carry trusted certificates.
+type listenConfig struct {
+	Addr          string
+	TLSAddr       string
+	CertFile      string
+	KeyFile       string
+	ClientCAFile  string
+	RedirectHTTPS bool
+}
+
+func (c listenConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("-tls-cert and -tls-key must be set together")
+	}
+	if c.TLSAddr != "" && c.CertFile == "" {
+		return errors.New("-tls-addr needs -tls-cert and -tls-key")
+	}
+	if c.RedirectHTTPS && c.TLSAddr == "" {
+		return errors.New("-redirect-https needs a separate -tls-addr")
+	}
+	if c.ClientCAFile != "" && c.CertFile == "" {
+		return errors.New("-tls-client-ca needs -tls-cert and -tls-key")
+	}
+	return nil
+}
+
+// tlsConfig is the TLS configuration for the HTTPS listener.
+func (c listenConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	if c.ClientCAFile == "" {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", c.ClientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
+
+// serveTLS serves HTTPS on addr.
+func (c listenConfig) serveTLS(addr string, handler http.Handler) error {
+	config, err := c.tlsConfig()
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: config}
+	return server.ListenAndServeTLS(c.CertFile, c.KeyFile)
+}
+
+// serve runs the listeners until one of them fails.
+func (c listenConfig) serve(handler http.Handler) error {
+	if c.CertFile == "" {
+		return http.ListenAndServe(c.Addr, handler)
+	}
+	if c.TLSAddr == "" {
+		return c.serveTLS(c.Addr, handler)
+	}
+	plain := handler
+	if c.RedirectHTTPS {
+		plain = redirectHTTPS(c.TLSAddr)
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- http.ListenAndServe(c.Addr, plain) }()
+	go func() { errs <- c.serveTLS(c.TLSAddr, handler) }()
+	return <-errs
+}
+
+// redirectHTTPS sends every request to the same URL over HTTPS, on the port
+// of tlsAddr. 308 keeps the method and body of POSTs.
+func redirectHTTPS(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	cases := []struct {
+		tlsAddr  string
+		url      string
+		location string
+	}{
+		{":443", "http://example.com/proxy/a?x=1", "https://example.com/proxy/a?x=1"},
+		{":8443", "http://example.com:8000/", "https://example.com:8443/"},
+		{"127.0.0.1:8443", "http://[::1]:8000/a", "https://[::1]:8443/a"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		redirectHTTPS(c.tlsAddr).ServeHTTP(rec, httptest.NewRequest("POST", c.url, nil))
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("Expected status %d, got %d", http.StatusPermanentRedirect, rec.Code)
+		}
+		if location := rec.Header().Get("Location"); location != c.location {
+			t.Errorf("Expected redirect from %s to %s, got %s", c.url, c.location, location)
+		}
+	}
+}
+
+func TestListenConfigValidate(t *testing.T) {
+	valid := []listenConfig{
+		{Addr: ":8000"},
+		{Addr: ":8000", CertFile: "cert.pem", KeyFile: "key.pem"},
+		{Addr: ":8000", TLSAddr: ":8443", CertFile: "cert.pem", KeyFile: "key.pem", RedirectHTTPS: true},
+		{Addr: ":8000", CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"},
+	}
+	for _, c := range valid {
+		if err := c.validate(); err != nil {
+			t.Errorf("Unexpected error %s for %+v", err, c)
+		}
+	}
+	invalid := []listenConfig{
+		{Addr: ":8000", CertFile: "cert.pem"},
+		{Addr: ":8000", TLSAddr: ":8443"},
+		{Addr: ":8000", CertFile: "cert.pem", KeyFile: "key.pem", RedirectHTTPS: true},
+		{Addr: ":8000", ClientCAFile: "ca.pem"},
+	}
+	for _, c := range invalid {
+		if err := c.validate(); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
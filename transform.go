@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// ResponseTransformer rewrites an upstream response before it is sent to the
+// client. Returning an error fails the request with a 502.
+type ResponseTransformer interface {
+	Transform(res *http.Response) error
+}
+
+// ResponseTransformerFunc adapts a function to a ResponseTransformer.
+type ResponseTransformerFunc func(res *http.Response) error
+
+func (f ResponseTransformerFunc) Transform(res *http.Response) error {
+	return f(res)
+}
+
+// TransformerChain applies transformers in order, stopping at the first
+// error.
+type TransformerChain []ResponseTransformer
+
+func (c TransformerChain) Transform(res *http.Response) error {
+	for _, transformer := range c {
+		if err := transformer.Transform(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// responseChain is the proxy's full chain: the built-in option handling,
+// then the proxy's own Transformers, then response framing, which has to see
+// the final body.
+func (p *Proxy) responseChain() TransformerChain {
+	chain := TransformerChain{
+		ResponseTransformerFunc(func(res *http.Response) error {
+			stripRewrittenHead(res)
+			return nil
+		}),
+		ResponseTransformerFunc(p.limitResponse),
+		ResponseTransformerFunc(p.rewriteResponseURLs),
+	}
+	chain = append(chain, p.Transformers...)
+	if p.ServerTiming {
+		return append(chain, ResponseTransformerFunc(func(res *http.Response) error {
+			unframeForTrailer(res)
+			return nil
+		}))
+	}
+	return append(chain, ResponseTransformerFunc(p.applyContentLength))
+}
+
+// StatusRemap replaces upstream status codes, ex {404: 200}.
+type StatusRemap map[int]int
+
+func (m StatusRemap) Transform(res *http.Response) error {
+	if status, ok := m[res.StatusCode]; ok {
+		res.StatusCode = status
+		res.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	return nil
+}
+
+// HeaderRewrite sets and removes response headers.
+type HeaderRewrite struct {
+	Set    map[string]string
+	Remove []string
+}
+
+func (h HeaderRewrite) Transform(res *http.Response) error {
+	for _, name := range h.Remove {
+		res.Header.Del(name)
+	}
+	for name, value := range h.Set {
+		res.Header.Set(name, value)
+	}
+	return nil
+}
+
+// BodyReplace replaces every occurrence of Old in the response body with New.
+// The body is buffered to do it.
+type BodyReplace struct {
+	Old string
+	New string
+}
+
+func (b BodyReplace) Transform(res *http.Response) error {
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	body = bytes.ReplaceAll(body, []byte(b.Old), []byte(b.New))
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
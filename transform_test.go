@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordOrder is a transformer that notes when it ran.
+type recordOrder struct {
+	name  string
+	order *[]string
+}
+
+func (r recordOrder) Transform(res *http.Response) error {
+	*r.order = append(*r.order, r.name+":"+res.Status)
+	return nil
+}
+
+func TestTransformerChain(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Powered-By", "legacy")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found here"))
+	}))
+	defer backend.Close()
+
+	var order []string
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "chained", ProxyOptions{Transformers: []ResponseTransformer{
+		recordOrder{"first", &order},
+		StatusRemap{http.StatusNotFound: http.StatusOK},
+		recordOrder{"remapped", &order},
+		HeaderRewrite{Set: map[string]string{"X-Transformed": "yes"}, Remove: []string{"X-Powered-By"}},
+		BodyReplace{Old: "not found", New: "found"},
+	}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/proxy/chained/")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the status to be remapped to 200, got %d", res.StatusCode)
+	}
+	if res.Header.Get("X-Transformed") != "yes" || res.Header.Get("X-Powered-By") != "" {
+		t.Errorf("Expected the headers to be rewritten, got %v", res.Header)
+	}
+	if string(body) != "found here" || res.ContentLength != int64(len("found here")) {
+		t.Errorf("Expected the body to be rewritten, got %q (%d)", body, res.ContentLength)
+	}
+	if len(order) != 2 || order[0] != "first:404 Not Found" || order[1] != "remapped:200 OK" {
+		t.Errorf("Expected transformers to run in order, got %v", order)
+	}
+}
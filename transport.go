@@ -0,0 +1,189 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+const (
+	DefaultKeepAlive           = 30 * time.Second
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 32
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// NewDialer returns the dialer used for upstream connections. keepAlive is the
+// interval between TCP keep-alive probes, so dead idle connections are noticed.
+func NewDialer(keepAlive time.Duration) *Dialer {
+	return &Dialer{
+		Dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: keepAlive,
+		},
+		FallbackDelay: DefaultFallbackDelay,
+	}
+}
+
+// NewTransport returns the transport shared by all proxies. It keeps more
+// idle connections per host than http.DefaultTransport's 2, since a proxy
+// talks to few hosts a lot and would otherwise churn connections under load.
+func NewTransport(dialer *Dialer) *http.Transport {
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+		TLSHandshakeTimeout: DefaultTLSHandshakeTimeout,
+	}
+}
+
+// proxyTransport is a proxy's own copy of the shared transport, remembering
+// the upstream proxy and timeout it was built for.
+type proxyTransport struct {
+	upstreamProxy string
+	timeout       time.Duration
+	transport     *http.Transport
+}
+
+// timeoutFor returns how long the proxy's upstream requests may take: its own
+// Timeout, or the app's RequestTimeout. Zero means no limit.
+func (app *App) timeoutFor(proxy *Proxy) time.Duration {
+	if proxy.Timeout != 0 {
+		return proxy.Timeout
+	}
+	return app.RequestTimeout
+}
+
+// transportFor returns the transport for a proxy's upstream traffic. Each
+// proxy gets its own copy of the shared transport, so its connection pool can
+// be reloaded without disturbing the others. Proxies with an UpstreamProxy
+// always go through it, ignoring the environment. Waiting for response
+// headers is bounded by the proxy's timeout.
+func (app *App) transportFor(proxy *Proxy) http.RoundTripper {
+	base, ok := app.Transport.(*http.Transport)
+	if !ok {
+		return app.Transport
+	}
+	app.transportsLock.Lock()
+	defer app.transportsLock.Unlock()
+	timeout := app.timeoutFor(proxy)
+	if cached, ok := app.transports[proxy.Path]; ok {
+		if cached.upstreamProxy == proxy.UpstreamProxy && cached.timeout == timeout {
+			return cached.transport
+		}
+		cached.transport.CloseIdleConnections()
+	}
+	transport := base.Clone()
+	if timeout > 0 {
+		transport.ResponseHeaderTimeout = timeout
+	}
+	if proxy.UpstreamProxy != "" {
+		proxyURL, err := url.Parse(proxy.UpstreamProxy)
+		if err != nil {
+			return app.Transport
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if app.transports == nil {
+		app.transports = make(map[string]*proxyTransport)
+	}
+	app.transports[proxy.Path] = &proxyTransport{upstreamProxy: proxy.UpstreamProxy, timeout: timeout, transport: transport}
+	return transport
+}
+
+// proxyRemoved drops what was built for a proxy that left the store, so
+// removed proxies don't keep transports and idle connections around.
+// Evictions are audited here since no request asked for them.
+func (app *App) proxyRemoved(proxy *Proxy, reason RemovalReason) {
+	app.ReloadTransport(proxy)
+	if reason == RemovedByEviction {
+		app.AuditSystem("evict", proxy.Path, proxy.Target(), "")
+	}
+}
+
+// ReloadTransport closes the proxy's idle upstream connections and discards
+// its transport, so the next request starts with fresh connections.
+func (app *App) ReloadTransport(proxy *Proxy) {
+	app.transportsLock.Lock()
+	defer app.transportsLock.Unlock()
+	if cached, ok := app.transports[proxy.Path]; ok {
+		cached.transport.CloseIdleConnections()
+		delete(app.transports, proxy.Path)
+	}
+	delete(app.handlers, proxy.Path)
+}
+
+// handlerSettings are the app settings a proxy's handler is built from.
+type handlerSettings struct {
+	via     string
+	retries int
+	timeout time.Duration
+	budget  *RetryBudget
+	logger  *log.Logger
+}
+
+func (app *App) handlerSettings(proxy *Proxy) handlerSettings {
+	return handlerSettings{
+		via:     app.Via,
+		retries: app.retriesFor(proxy),
+		timeout: app.timeoutFor(proxy),
+		budget:  app.RetryBudget,
+		logger:  app.Logger,
+	}
+}
+
+// cachedHandler is the handler built for a proxy with the app's settings at
+// the time.
+type cachedHandler struct {
+	proxy     *Proxy
+	settings  handlerSettings
+	transport http.RoundTripper
+	handler   http.Handler
+}
+
+// reusable reports whether the handler still fits proxy. Proxies are never
+// modified once stored, so the same instance is the same proxy; Find copies
+// proxies to merge their group defaults, so such copies count too while the
+// defaults are unchanged.
+func (c *cachedHandler) reusable(proxy *Proxy, settings handlerSettings, transport http.RoundTripper) bool {
+	if c.settings != settings || !sameRoundTripper(c.transport, transport) {
+		return false
+	}
+	return c.proxy == proxy || c.proxy.roundRobin == proxy.roundRobin && reflect.DeepEqual(c.proxy.ProxyDefaults, proxy.ProxyDefaults)
+}
+
+// handlerFor returns the handler forwarding to proxy, built once and reused
+// until the proxy or the app's settings change, so requests don't each pay
+// for a new ReverseProxy and transport chain.
+func (app *App) handlerFor(proxy *Proxy) http.Handler {
+	settings := app.handlerSettings(proxy)
+	app.transportsLock.Lock()
+	cached, ok := app.handlers[proxy.Path]
+	app.transportsLock.Unlock()
+	if ok && cached.reusable(proxy, settings, app.Transport) {
+		return cached.handler
+	}
+	handler := app.proxyHandler(proxy)
+	app.transportsLock.Lock()
+	defer app.transportsLock.Unlock()
+	if app.handlers == nil {
+		app.handlers = make(map[string]*cachedHandler)
+	}
+	app.handlers[proxy.Path] = &cachedHandler{proxy: proxy, settings: settings, transport: app.Transport, handler: handler}
+	return handler
+}
+
+// sameRoundTripper compares transports without panicking on ones that
+// can't be compared, such as funcs, which never match.
+func sameRoundTripper(a http.RoundTripper, b http.RoundTripper) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || a != nil && !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewDialerKeepAlive(t *testing.T) {
+	dialer := NewDialer(15 * time.Second)
+	if dialer.KeepAlive != 15*time.Second {
+		t.Errorf("Expected keepalive %s, got %s", 15*time.Second, dialer.KeepAlive)
+	}
+}
+
+func TestNewTransportUsesDialer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	transport := NewTransport(NewDialer(DefaultKeepAlive))
+	if transport.DialContext == nil {
+		t.Fatal("Expected transport to dial through the configured dialer")
+	}
+	res, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	res.Body.Close()
+}
+
+func TestUpstreamProxy(t *testing.T) {
+	var lock sync.Mutex
+	var forwarded []string
+	forwardProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		forwarded = append(forwarded, r.URL.Host)
+		lock.Unlock()
+		w.Write([]byte("via forward proxy"))
+	}))
+	defer forwardProxy.Close()
+
+	app := Subject()
+	app.RegisterWithOptions("http://backend.invalid", "corp", ProxyOptions{UpstreamProxy: forwardProxy.URL})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		if content := get(t, server.URL+"/proxy/corp/"); content != "via forward proxy" {
+			t.Errorf("Expected the response from the forward proxy, got %s", content)
+		}
+	}
+	if len(forwarded) != 2 || forwarded[0] != "backend.invalid" {
+		t.Errorf("Expected upstream requests to go through the forward proxy, got %v", forwarded)
+	}
+	proxy, _ := app.Find("corp")
+	if app.transportFor(proxy) != app.transportFor(proxy) {
+		t.Error("Expected the upstream proxy transport to be reused")
+	}
+}
+
+func TestReloadTransportClosesIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 10)
+	var lock sync.Mutex
+	opened := 0
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			lock.Lock()
+			opened++
+			lock.Unlock()
+		case http.StateClosed:
+			closed <- struct{}{}
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "pooled")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	get(t, server.URL+"/proxy/pooled/")
+	get(t, server.URL+"/proxy/pooled/")
+	lock.Lock()
+	if opened != 1 {
+		t.Errorf("Expected the idle connection to be reused, got %d connections", opened)
+	}
+	lock.Unlock()
+
+	if res, _ := postJSON(t, server.URL+"/api/proxies/pooled/reload"); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the idle upstream connection to be closed")
+	}
+
+	get(t, server.URL+"/proxy/pooled/")
+	lock.Lock()
+	if opened != 2 {
+		t.Errorf("Expected a fresh connection after reload, got %d connections", opened)
+	}
+	lock.Unlock()
+}
+
+func TestPerProxyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-release:
+		}
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	app := Subject()
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.RequestTimeout = 50 * time.Millisecond
+	app.Register(slow.URL, "tight")
+	app.RegisterWithOptions(slow.URL, "loose", ProxyOptions{ProxyDefaults: ProxyDefaults{Timeout: 5 * time.Second}})
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	tight, _ := app.Find("tight")
+	if transport, ok := app.transportFor(tight).(*http.Transport); !ok || transport.ResponseHeaderTimeout != 50*time.Millisecond {
+		t.Errorf("Expected the default timeout to bound response headers, got %v", transport)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/tight/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, res.StatusCode)
+	}
+	req, _ = http.NewRequest("GET", server.URL+"/proxy/loose/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the looser timeout to wait for the backend, got %d", res.StatusCode)
+	}
+}
+
+func TestNewTransportPooling(t *testing.T) {
+	transport := NewTransport(NewDialer(DefaultKeepAlive))
+	if transport.MaxIdleConns != DefaultMaxIdleConns || transport.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost {
+		t.Errorf("Expected idle limits %d and %d per host, got %d and %d", DefaultMaxIdleConns, DefaultMaxIdleConnsPerHost, transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != DefaultIdleConnTimeout || transport.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout {
+		t.Errorf("Expected timeouts %s and %s, got %s and %s", DefaultIdleConnTimeout, DefaultTLSHandshakeTimeout, transport.IdleConnTimeout, transport.TLSHandshakeTimeout)
+	}
+}
+
+func TestHandlerCachedPerProxy(t *testing.T) {
+	app := Subject()
+	app.Register("http://localhost:9000", "cached")
+	first, _ := app.Find("cached")
+	handler := app.handlerFor(first)
+	again, _ := app.Find("cached")
+	if app.handlerFor(again) != handler {
+		t.Errorf("Expected the handler to be reused for the same proxy")
+	}
+
+	app.Update("http://localhost:9001", "cached")
+	updated, _ := app.Find("cached")
+	if app.handlerFor(updated) == handler {
+		t.Errorf("Expected a new handler once the proxy is updated")
+	}
+	handler = app.handlerFor(updated)
+	app.Via = ""
+	if app.handlerFor(updated) == handler {
+		t.Errorf("Expected a new handler once the app's settings change")
+	}
+}
+
+func TestRemovedProxiesDropTransports(t *testing.T) {
+	store := NewStore()
+	store.MaxProxies = 2
+	store.Eviction = EvictLRU
+	app := NewApp(template.Must(LoadTemplates("")), store)
+	app.Setup()
+	cached := func(path string) bool {
+		app.transportsLock.Lock()
+		defer app.transportsLock.Unlock()
+		_, transport := app.transports[path]
+		_, handler := app.handlers[path]
+		return transport || handler
+	}
+	use := func(path string) {
+		proxy, err := app.Find(path)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		app.handlerFor(proxy)
+		if !cached(path) {
+			t.Fatalf("Expected %s to have a cached handler", path)
+		}
+	}
+
+	app.Register("http://localhost:9000", "gone")
+	use("gone")
+	app.Unregister("gone")
+	if cached("gone") {
+		t.Errorf("Expected unregistering to drop the transport and handler")
+	}
+
+	app.Register("http://localhost:9000", "old")
+	use("old")
+	app.Rename("old", "new")
+	if cached("old") {
+		t.Errorf("Expected renaming to drop the old path's transport and handler")
+	}
+
+	use("new")
+	app.Register("http://localhost:9001", "kept")
+	use("kept")
+	app.Register("http://localhost:9002", "evicting")
+	if cached("new") {
+		t.Errorf("Expected eviction to drop the transport and handler")
+	}
+	if !cached("kept") {
+		t.Errorf("Expected kept proxies to keep their handler")
+	}
+}
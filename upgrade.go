@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isUpgrade reports whether req asks to switch protocols, as websocket
+// handshakes do. Once switched, the connection is relayed as is until either
+// side closes it: the response options, caching and the request timeout
+// don't apply, though the timeout still bounds the handshake.
+func isUpgrade(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
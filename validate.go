@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// validateConfigCommand checks the config file at path without starting the
+// server, printing a report to out. It returns the process exit code: 0 when
+// every proxy is valid, 1 otherwise.
+func (app *App) validateConfigCommand(path string, out io.Writer) int {
+	config, errs, err := LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(out, "error: %s\n", err)
+		return 1
+	}
+	checked := len(config.Proxies) + len(errs)
+	errs = append(errs, app.ValidateConfig(config)...)
+	for _, err := range errs {
+		fmt.Fprintf(out, "error: %s\n", err)
+	}
+	fmt.Fprintf(out, "%d proxies checked, %d errors\n", checked, len(errs))
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
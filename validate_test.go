@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "reverser")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return path
+}
+
+func TestValidateConfigCommand(t *testing.T) {
+	app := Subject()
+	valid := writeConfig(t, `{"proxies": [
+		{"path": "api", "target": "http://api.example.com"},
+		{"path": "web", "target": "http://web1.example.com,http://web2.example.com"}
+	]}`)
+	var out bytes.Buffer
+	if code := app.validateConfigCommand(valid, &out); code != 0 {
+		t.Errorf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "2 proxies checked, 0 errors") {
+		t.Errorf("Expected a summary, got %s", out.String())
+	}
+
+	invalid := writeConfig(t, `{"proxies": [
+		{"path": "api", "target": "http://api.example.com"},
+		{"path": "", "target": "http://nopath.example.com"},
+		{"path": "api", "target": "http://again.example.com"},
+		{"path": "bad", "target": "http://bad host"}
+	]}`)
+	out.Reset()
+	if code := app.validateConfigCommand(invalid, &out); code == 0 {
+		t.Error("Expected a non-zero exit code for an invalid config")
+	}
+	for _, message := range []string{"no path", "api is listed twice", "bad:", "4 proxies checked, 3 errors"} {
+		if !strings.Contains(out.String(), message) {
+			t.Errorf("Expected %q in the report, got %s", message, out.String())
+		}
+	}
+	if len(app.ProxyList()) != 0 {
+		t.Error("Expected validation to leave the store untouched")
+	}
+
+	out.Reset()
+	if code := app.validateConfigCommand(writeConfig(t, `{"proxies": [}`), &out); code == 0 || !strings.Contains(out.String(), "error:") {
+		t.Errorf("Expected a parse error, got %d: %s", code, out.String())
+	}
+}
+
+func TestLoadConfigSkipsBadEntries(t *testing.T) {
+	path := writeConfig(t, `{"version": 2, "proxies": [
+		{"path": "api", "target": "http://api.example.com"},
+		{"path": "typo", "taget": "http://typo.example.com"},
+		{"path": 7, "target": "http://seven.example.com"},
+		{"path": "web", "target": "http://web.example.com"}
+	]}`)
+	config, errs, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(config.Proxies) != 2 || config.Proxies[0].Path != "api" || config.Proxies[1].Path != "web" {
+		t.Errorf("Expected api and web to be loaded, got %+v", config.Proxies)
+	}
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "entry 2") || !strings.Contains(errs[1].Error(), "entry 3") {
+		t.Errorf("Expected entries 2 and 3 to be reported, got %v", errs)
+	}
+
+	app := Subject()
+	var out bytes.Buffer
+	if code := app.validateConfigCommand(path, &out); code == 0 {
+		t.Error("Expected validation to fail on entries with unknown fields")
+	}
+	if !strings.Contains(out.String(), "4 proxies checked, 2 errors") {
+		t.Errorf("Expected a summary, got %s", out.String())
+	}
+}
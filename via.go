@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const DefaultVia = "reverser"
+
+// appendVia adds this hop to the Via chain, as RFC 7230 section 5.7.1 asks of
+// proxies, keeping any earlier entries.
+func appendVia(header http.Header, protoMajor int, protoMinor int, pseudonym string) {
+	protocol := fmt.Sprintf("%d.%d", protoMajor, protoMinor)
+	if protoMajor >= 2 {
+		protocol = fmt.Sprintf("%d", protoMajor)
+	}
+	entry := protocol + " " + pseudonym
+	header.Set("Via", strings.Join(append(header.Values("Via"), entry), ", "))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViaHeader(t *testing.T) {
+	var upstreamVia string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamVia = r.Header.Get("Via")
+		w.Header().Set("Via", "1.1 backend-cache")
+	}))
+	defer backend.Close()
+
+	app := Subject()
+	app.Register(backend.URL, "testing")
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/testing/", nil)
+	req.Header.Set("Via", "1.0 edge")
+	res := status(t, req)
+
+	if upstreamVia != "1.0 edge, 1.1 reverser" {
+		t.Errorf("Expected the upstream Via chain to be appended to, got %q", upstreamVia)
+	}
+	if via := res.Header.Get("Via"); via != "1.1 backend-cache, 1.1 reverser" {
+		t.Errorf("Expected the response Via chain to be appended to, got %q", via)
+	}
+
+	app.Via = ""
+	res = status(t, req)
+	if upstreamVia != "1.0 edge" {
+		t.Errorf("Expected Via to be left alone when disabled, got %q", upstreamVia)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoUpgradeServer completes a websocket style upgrade and then echoes
+// whatever the client sends until it hangs up.
+func echoUpgradeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	}))
+}
+
+func upgrade(t *testing.T, server *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", path, server.Listener.Addr())
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status %d, got %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+	return conn, reader
+}
+
+func TestWebSocketPassthrough(t *testing.T) {
+	backend := echoUpgradeServer()
+	defer backend.Close()
+
+	options := map[string]ProxyOptions{
+		"plain":   {},
+		"cached":  {CacheTTL: time.Minute},
+		"limited": {MaxResponseBytes: 1024, ContentLength: ContentLengthBuffer},
+		"timeout": {ProxyDefaults: ProxyDefaults{Timeout: 100 * time.Millisecond}},
+		"timing":  {ServerTiming: true},
+	}
+	app := Subject()
+	for path, opts := range options {
+		app.RegisterWithOptions(backend.URL, path, opts)
+	}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	// A text frame with the payload "hi", masked with a zero key.
+	frame := []byte{0x81, 0x82, 0, 0, 0, 0, 'h', 'i'}
+	for path := range options {
+		conn, reader := upgrade(t, server, "/proxy/"+path+"/socket")
+		for i := 0; i < 2; i++ {
+			if i > 0 {
+				// Outlive the request timeout to show it doesn't cut the socket.
+				time.Sleep(150 * time.Millisecond)
+			}
+			conn.Write(frame)
+			echoed := make([]byte, len(frame))
+			if _, err := io.ReadFull(reader, echoed); err != nil {
+				t.Errorf("Expected %s to echo the frame, got %s", path, err)
+				break
+			}
+			if string(echoed) != string(frame) {
+				t.Errorf("Expected %s to echo %v, got %v", path, frame, echoed)
+			}
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaintenanceWindow is a recurring period, in UTC, during which a proxy
+// serves the maintenance page instead of forwarding. Start and End are
+// "15:04" times of day; an End at or before Start runs past midnight. Days
+// limits the window to the days it starts on, every day when empty.
+type MaintenanceWindow struct {
+	Days  []time.Weekday `json:",omitempty"`
+	Start string
+	End   string
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w MaintenanceWindow) validate() error {
+	if _, err := parseTimeOfDay(w.Start); err != nil {
+		return err
+	}
+	_, err := parseTimeOfDay(w.End)
+	return err
+}
+
+func (w MaintenanceWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether t falls inside the window.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return false
+	}
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	now := t.Sub(midnight)
+	if start < end {
+		return now >= start && now < end && w.startsOn(t.Weekday())
+	}
+	// Past midnight: the evening part belongs to today's window, the early
+	// morning part to yesterday's.
+	if now >= start {
+		return w.startsOn(t.Weekday())
+	}
+	return now < end && w.startsOn(midnight.AddDate(0, 0, -1).Weekday())
+}
+
+// InMaintenance reports whether now falls in any of the proxy's
+// MaintenanceWindows.
+func (p *Proxy) InMaintenance(now time.Time) bool {
+	for _, window := range p.MaintenanceWindows {
+		if window.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	window := MaintenanceWindow{Days: []time.Weekday{time.Saturday}, Start: "22:00", End: "02:00"}
+	saturday := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[time.Duration]bool{
+		21 * time.Hour:             false,
+		23 * time.Hour:             true,
+		24*time.Hour + time.Hour:   true,
+		24*time.Hour + 3*time.Hour: false,
+		-23 * time.Hour:            false,
+	}
+	for offset, want := range cases {
+		at := saturday.Add(offset)
+		if got := window.Contains(at); got != want {
+			t.Errorf("Expected Contains(%s) to be %v, got %v", at, want, got)
+		}
+	}
+}
+
+func TestMaintenanceWindowProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	now := time.Now().UTC()
+	clock := func(d time.Duration) string { return now.Add(d).Format("15:04") }
+	app := Subject()
+	app.RegisterWithOptions(backend.URL, "inside", ProxyOptions{
+		MaintenanceWindows: []MaintenanceWindow{{Start: clock(-time.Hour), End: clock(time.Hour)}},
+	})
+	app.RegisterWithOptions(backend.URL, "outside", ProxyOptions{
+		MaintenanceWindows: []MaintenanceWindow{{Start: clock(time.Hour), End: clock(2 * time.Hour)}},
+	})
+	if err := app.RegisterWithOptions(backend.URL, "invalid", ProxyOptions{
+		MaintenanceWindows: []MaintenanceWindow{{Start: "25:00", End: "26:00"}},
+	}); err == nil {
+		t.Error("Expected an invalid window to be rejected")
+	}
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/proxy/inside/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d inside the window, got %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	req, _ = http.NewRequest("GET", server.URL+"/proxy/outside/", nil)
+	if res := status(t, req); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d outside the window, got %d", http.StatusOK, res.StatusCode)
+	}
+}